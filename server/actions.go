@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/i18n"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+// the confirmation is posted to the same url, so that links opened by mail
+// scanners do not execute the actions
+const actionPage = `<html><head><meta charset="utf-8"><title>%s</title></head>
+<body style="font-family: sans-serif; max-width: 600px; margin: 40px auto;">
+<h2>%s</h2>
+<p>%s</p>
+%s
+</body></html>`
+
+func writeActionPage(w http.ResponseWriter, status int, locale string, message string, form string) {
+	title := html.EscapeString(i18n.T(locale, "action.title"))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, actionPage, title, title, html.EscapeString(message), form)
+}
+
+// executes the actions of the signed links in the digests. The links are
+// authenticated by their token, so no Mattermost session is needed. Mail
+// clients supporting one-click unsubscribe (RFC 8058) post to the link directly
+func (p *MANPlugin) serveAction(w http.ResponseWriter, r *http.Request) {
+	token, errT := p.backend.ParseActionToken(r.FormValue("token"))
+	if errT != nil {
+		p.backend.LogWarn("Invalid action link: %s", errT)
+		writeActionPage(w, http.StatusForbidden, i18n.DefaultLocale, i18n.T(i18n.DefaultLocale, "action.invalid"), "")
+		return
+	}
+
+	user, errU := p.backend.GetUser(token.UserID)
+	if errU != nil {
+		p.backend.LogError("Error getting user %s: %s", token.UserID, errU)
+		writeActionPage(w, http.StatusInternalServerError, i18n.DefaultLocale, i18n.T(i18n.DefaultLocale, "action.error"), "")
+		return
+	}
+
+	channelName := ""
+	if token.ChannelID != "" {
+		channel, errC := p.backend.GetChannel(token.ChannelID)
+		if errC != nil {
+			p.backend.LogError("Error getting channel %s: %s", token.ChannelID, errC)
+			writeActionPage(w, http.StatusInternalServerError, user.Locale, i18n.T(user.Locale, "action.error"), "")
+			return
+		}
+		channelName = channel.GetChannelName(user)
+	}
+
+	// links can be used only once
+	used, errUsed := p.backend.IsActionTokenUsed(token)
+	if errUsed != nil {
+		p.backend.LogError("Error checking action link: %s", errUsed)
+		writeActionPage(w, http.StatusInternalServerError, user.Locale, i18n.T(user.Locale, "action.error"), "")
+		return
+	}
+	if used {
+		writeActionPage(w, http.StatusGone, user.Locale, i18n.T(user.Locale, "action.used"), "")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var message string
+		if channelName != "" {
+			message = i18n.T(user.Locale, "action.confirm."+token.Action, user.Username, channelName)
+		} else {
+			message = i18n.T(user.Locale, "action.confirm."+token.Action, user.Username)
+		}
+		form := fmt.Sprintf(`<form method="post"><input type="hidden" name="token" value="%s"><button type="submit">%s</button></form>`,
+			html.EscapeString(r.FormValue("token")), html.EscapeString(i18n.T(user.Locale, "action.button")))
+		writeActionPage(w, http.StatusOK, user.Locale, message, form)
+
+	case http.MethodPost:
+		// the token is marked as used before executing the action, so that
+		// concurrent requests with the same link execute it once
+		saved, errS := p.backend.UseActionToken(token)
+		if errS != nil {
+			p.backend.LogError("Error saving used action link: %s", errS)
+			writeActionPage(w, http.StatusInternalServerError, user.Locale, i18n.T(user.Locale, "action.error"), "")
+			return
+		}
+		if !saved {
+			writeActionPage(w, http.StatusGone, user.Locale, i18n.T(user.Locale, "action.used"), "")
+			return
+		}
+
+		result, errE := p.executeAction(user, token, channelName)
+
+		entry := &model.ActionAuditEntry{
+			Time:      time.Now().UnixMilli(),
+			UserID:    user.ID,
+			Username:  user.Username,
+			Action:    token.Action,
+			ChannelID: token.ChannelID,
+		}
+		if errE != nil {
+			entry.Error = errE.Error()
+		}
+		if errA := p.backend.AddActionAuditEntry(entry); errA != nil {
+			p.backend.LogError("Error saving the audit log: %s", errA)
+		}
+
+		if errE != nil {
+			p.backend.LogError("Error executing action %s for user %s: %s", token.Action, user.Username, errE)
+			// the link can be used again to retry
+			if errR := p.backend.ReleaseActionToken(token); errR != nil {
+				p.backend.LogError("Error releasing action link: %s", errR)
+			}
+			writeActionPage(w, http.StatusInternalServerError, user.Locale, i18n.T(user.Locale, "action.error"), "")
+			return
+		}
+		p.backend.LogInfo("User %s executed action %s from a link (channel: %s)", user.Username, token.Action, token.ChannelID)
+		writeActionPage(w, http.StatusOK, user.Locale, result, "")
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// executes the action and returns the message to show to the user
+func (p *MANPlugin) executeAction(user *model.User, token *model.ActionToken, channelName string) (string, error) {
+	done := "action.done." + token.Action
+
+	switch token.Action {
+	case model.ActionDisable:
+		return i18n.T(user.Locale, done), p.backend.SetUserPreference(user, "Enabled", false)
+
+	case model.ActionExcludeChannel:
+		errU := p.backend.UpdatePreferencesForUser(user.ID, func(prefs *model.MANUserPreferences) error {
+			prefs.SetChannelSetting(token.ChannelID, model.ChannelExclude)
+			return nil
+		})
+		return i18n.T(user.Locale, done, channelName), errU
+
+	case model.ActionSnooze:
+		until := time.Now().Add(model.ActionSnoozeDuration).UnixMilli()
+		errU := p.backend.UpdatePreferencesForUser(user.ID, func(prefs *model.MANUserPreferences) error {
+			// an ongoing longer pause is not shortened
+			if prefs.PausedUntil > until {
+				until = prefs.PausedUntil
+			}
+			prefs.PausedUntil = until
+			return nil
+		})
+		return i18n.T(user.Locale, done, time.UnixMilli(until).In(user.Location()).Format("Mon Jan 2 15:04 MST")), errU
+
+	case model.ActionMarkRead:
+		return i18n.T(user.Locale, done, channelName), p.backend.MarkChannelAsRead(user.ID, token.ChannelID)
+	}
+
+	return "", errors.Errorf("unknown action '%s'", token.Action)
+}
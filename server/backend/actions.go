@@ -0,0 +1,200 @@
+package backend
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	mm_model "github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+const actionKeyKey = "action_token_key"
+
+const actionAuditLogKey = "action_audit_log"
+
+// prefix of the keys of the used action tokens
+const usedActionTokenKeyPrefix = "action_used_"
+
+// only the most recent entries of the audit log are kept
+const actionAuditLogSize = 500
+
+// returns the key used to sign the action links. It is generated the first
+// time and stored in the kvstore
+func (mm *MattermostBackend) getActionTokenKey() ([]byte, error) {
+	mm.actionKeyLock.Lock()
+	defer mm.actionKeyLock.Unlock()
+
+	if mm.actionKey != nil {
+		return mm.actionKey, nil
+	}
+
+	key, errG := mm.api.KVGet(actionKeyKey)
+	if errG != nil {
+		return nil, errors.Wrap(errG, "Error getting action token key")
+	}
+
+	if key == nil {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, errors.Wrap(err, "Error generating action token key")
+		}
+		// another node could have generated it in the meantime
+		saved, errS := mm.api.KVSetWithOptions(actionKeyKey, key, mm_model.PluginKVSetOptions{Atomic: true, OldValue: nil})
+		if errS != nil {
+			return nil, errors.Wrap(errS, "Error saving action token key")
+		}
+		if !saved {
+			key, errG = mm.api.KVGet(actionKeyKey)
+			if errG != nil || key == nil {
+				return nil, errors.New("Error getting action token key")
+			}
+		}
+	}
+
+	mm.actionKey = key
+	return key, nil
+}
+
+// returns the link that executes the action for the user. The link does not
+// need a Mattermost session and expires after model.ActionTokenValidity
+func (mm *MattermostBackend) BuildActionURL(userID string, action string, channelID string) (string, error) {
+	key, errK := mm.getActionTokenKey()
+	if errK != nil {
+		return "", errK
+	}
+
+	token, errT := model.SignActionToken(key, &model.ActionToken{
+		UserID:    userID,
+		Action:    action,
+		ChannelID: channelID,
+		ExpiresAt: time.Now().Add(model.ActionTokenValidity).Unix(),
+		Nonce:     mm_model.NewId(),
+	})
+	if errT != nil {
+		return "", errT
+	}
+
+	return mm.GetPluginURL() + "/action?token=" + url.QueryEscape(token), nil
+}
+
+// returns the action in the signed token, if valid
+func (mm *MattermostBackend) ParseActionToken(signed string) (*model.ActionToken, error) {
+	key, errK := mm.getActionTokenKey()
+	if errK != nil {
+		return nil, errK
+	}
+	return model.ParseActionToken(key, signed, time.Now())
+}
+
+// records the token as used and returns false if it had already been used.
+// The record expires together with the token
+func (mm *MattermostBackend) UseActionToken(token *model.ActionToken) (bool, error) {
+	expiresIn := time.Until(time.Unix(token.ExpiresAt, 0))
+	if expiresIn < time.Second {
+		expiresIn = time.Second
+	}
+
+	saved, errS := mm.api.KVSetWithOptions(usedActionTokenKeyPrefix+token.Nonce, []byte{1}, mm_model.PluginKVSetOptions{
+		Atomic:          true,
+		OldValue:        nil,
+		ExpireInSeconds: int64(expiresIn.Seconds()),
+	})
+	if errS != nil {
+		return false, errors.Wrap(errS, "Error saving used action token")
+	}
+	return saved, nil
+}
+
+// allows to use again a token, e.g. if the action failed
+func (mm *MattermostBackend) ReleaseActionToken(token *model.ActionToken) error {
+	if errD := mm.api.KVDelete(usedActionTokenKeyPrefix + token.Nonce); errD != nil {
+		return errors.Wrap(errD, "Error deleting used action token")
+	}
+	return nil
+}
+
+// returns true if the token has already been used
+func (mm *MattermostBackend) IsActionTokenUsed(token *model.ActionToken) (bool, error) {
+	value, errG := mm.api.KVGet(usedActionTokenKeyPrefix + token.Nonce)
+	if errG != nil {
+		return false, errors.Wrap(errG, "Error getting used action token")
+	}
+	return value != nil, nil
+}
+
+func (mm *MattermostBackend) AddActionAuditEntry(entry *model.ActionAuditEntry) error {
+	mm.actionAuditLock.Lock()
+	defer mm.actionAuditLock.Unlock()
+
+	entries, errG := mm.getActionAuditLog()
+	if errG != nil {
+		return errG
+	}
+
+	entries = append(entries, entry)
+	if len(entries) > actionAuditLogSize {
+		entries = entries[len(entries)-actionAuditLogSize:]
+	}
+
+	ser, errSer := json.Marshal(entries)
+	if errSer != nil {
+		return errors.Wrap(errSer, "Error serializing action audit log")
+	}
+	if errSet := mm.api.KVSet(actionAuditLogKey, ser); errSet != nil {
+		return errors.Wrap(errSet, "Error saving action audit log")
+	}
+	return nil
+}
+
+// returns the actions executed from the links, from the oldest to the newest
+func (mm *MattermostBackend) GetActionAuditLog() ([]*model.ActionAuditEntry, error) {
+	mm.actionAuditLock.Lock()
+	defer mm.actionAuditLock.Unlock()
+
+	return mm.getActionAuditLog()
+}
+
+func (mm *MattermostBackend) getActionAuditLog() ([]*model.ActionAuditEntry, error) {
+	bytes, errG := mm.api.KVGet(actionAuditLogKey)
+	if errG != nil {
+		return nil, errors.Wrap(errG, "Error getting action audit log")
+	}
+
+	entries := []*model.ActionAuditEntry{}
+	if bytes == nil {
+		return entries, nil
+	}
+	if err := json.Unmarshal(bytes, &entries); err != nil {
+		return nil, errors.Wrap(err, "Error unserializing action audit log")
+	}
+	return entries, nil
+}
+
+// marks the channel as read for the user. The plugin API cannot view a
+// channel, so the read state of the membership is updated in the db. The
+// notification properties are then saved again with the plugin API, so that
+// the server invalidates its caches and the clients of the user are updated
+func (mm *MattermostBackend) MarkChannelAsRead(userID string, channelID string) error {
+	member, errM := mm.api.GetChannelMember(channelID, userID)
+	if errM != nil {
+		return errors.Wrap(errM, "Error getting channel membership")
+	}
+
+	query := fmt.Sprintf("UPDATE ChannelMembers SET MentionCount = 0, MentionCountRoot = 0, UrgentMentionCount = 0, MsgCount = (SELECT TotalMsgCount FROM Channels WHERE Id = %s), MsgCountRoot = (SELECT TotalMsgCountRoot FROM Channels WHERE Id = %s), LastViewedAt = %s, LastUpdateAt = %s WHERE ChannelId = %s AND UserId = %s",
+		mm.sqlPlaceholder(1), mm.sqlPlaceholder(2), mm.sqlPlaceholder(3), mm.sqlPlaceholder(4), mm.sqlPlaceholder(5), mm.sqlPlaceholder(6))
+
+	now := time.Now().UnixMilli()
+	if _, err := mm.db.Exec(query, channelID, channelID, now, now, channelID, userID); err != nil {
+		return errors.Wrap(err, "Error updating channel membership")
+	}
+
+	if _, errU := mm.api.UpdateChannelMemberNotifications(channelID, userID, member.NotifyProps); errU != nil {
+		return errors.Wrap(errU, "Error updating channel membership")
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package backend
+
+import (
+	mm_model "github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+const botUsername = "missedactivity"
+
+// creates (or updates) the bot used to send digests as direct messages
+func (mm *MattermostBackend) EnsureBot() error {
+	botUserID, err := mm.api.EnsureBotUser(&mm_model.Bot{
+		Username:    botUsername,
+		DisplayName: "Missed Activity",
+		Description: "Sends the digests of the Missed Activity Notifier plugin",
+	})
+	if err != nil {
+		return errors.Wrap(err, "error ensuring bot user")
+	}
+	mm.botUserID = botUserID
+	return nil
+}
+
+// true if the bot has been created and digests can be sent as direct messages
+func (mm *MattermostBackend) IsBotAvailable() bool {
+	return mm.botUserID != ""
+}
+
+// posts the message in the direct channel between the bot and the user
+func (mm *MattermostBackend) SendDirectMessage(user *model.User, message string) error {
+	if !mm.IsBotAvailable() {
+		return errors.New("bot user not available")
+	}
+
+	channel, errC := mm.api.GetDirectChannel(mm.botUserID, user.ID)
+	if errC != nil {
+		return errors.Wrap(errC, "error getting direct channel with the bot")
+	}
+
+	_, errP := mm.api.CreatePost(&mm_model.Post{
+		UserId:    mm.botUserID,
+		ChannelId: channel.Id,
+		Message:   message,
+	})
+	if errP != nil {
+		return errors.Wrap(errP, "error posting direct message")
+	}
+	return nil
+}
@@ -30,6 +30,7 @@ func (mm *MattermostBackend) GetChannel(channelID string) (*model.Channel, error
 
 	res := &model.Channel{
 		ID:          channel.Id,
+		Name:        channel.Name,
 		DisplayName: channel.DisplayName,
 		Type:        string(channel.Type),
 		TeamID:      channel.TeamId,
@@ -56,6 +57,15 @@ func (mm *MattermostBackend) GetChannel(channelID string) (*model.Channel, error
 	return res, nil
 }
 
+// returns the channel with the given name (the one in the url) in the team
+func (mm *MattermostBackend) GetChannelByName(teamID string, name string) (*model.Channel, error) {
+	channel, err := mm.api.GetChannelByName(teamID, name, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting channel by name")
+	}
+	return mm.GetChannel(channel.Id)
+}
+
 // returns the list of posts in a channel between two given timestamp.
 // The returned list of posts also includes root posts even of the
 // requested range to let the caller be able to rebuild the threads.
@@ -178,6 +188,11 @@ func (mm *MattermostBackend) GetChannelMembersForUser(teamID string, userID stri
 			return nil, fmt.Errorf("error getting channel while getting channel memberships: %s", err)
 		}
 
+		// digests sent as direct messages by the plugin bot are not missed activity
+		if mm.botUserID != "" && ch.IsDirect() && ch.Name == mm_model.GetDMNameFromIds(userID, mm.botUserID) {
+			continue
+		}
+
 		// the api call GetChannelMembersForUser returns all memberships in ALL teams
 		// so we remove the ones in other teams
 		if ch.TeamID == teamID || (includeDirectMessages && ch.TeamID == "") {
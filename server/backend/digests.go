@@ -0,0 +1,52 @@
+package backend
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+// the past digests of each user are stored in their own key
+const digestsKeyPrefix = "digests_"
+
+// adds the digest to the archive of the user. Only the most recent
+// model.DigestArchiveSize digests are kept
+func (mm *MattermostBackend) ArchiveDigest(userID string, digest *model.ArchivedDigest) error {
+	digests, errG := mm.GetArchivedDigests(userID)
+	if errG != nil {
+		return errG
+	}
+
+	digests = append(digests, digest)
+	if len(digests) > model.DigestArchiveSize {
+		digests = digests[len(digests)-model.DigestArchiveSize:]
+	}
+
+	ser, errSer := json.Marshal(digests)
+	if errSer != nil {
+		return errors.Wrap(errSer, "Error serializing digests archive")
+	}
+	if errSet := mm.api.KVSet(digestsKeyPrefix+userID, ser); errSet != nil {
+		return errors.Wrap(errSet, "Error saving digests archive")
+	}
+	return nil
+}
+
+// returns the past digests of the user, from the oldest to the newest
+func (mm *MattermostBackend) GetArchivedDigests(userID string) ([]*model.ArchivedDigest, error) {
+	bytes, errG := mm.api.KVGet(digestsKeyPrefix + userID)
+	if errG != nil {
+		return nil, errors.Wrap(errG, "Error getting digests archive")
+	}
+
+	digests := []*model.ArchivedDigest{}
+	if bytes == nil {
+		return digests, nil
+	}
+	if err := json.Unmarshal(bytes, &digests); err != nil {
+		return nil, errors.Wrap(err, "Error unserializing digests archive")
+	}
+	return digests, nil
+}
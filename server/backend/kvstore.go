@@ -2,6 +2,7 @@ package backend
 
 import (
 	"encoding/json"
+	"reflect"
 	"time"
 
 	"github.com/oleiade/reflections"
@@ -10,12 +11,27 @@ import (
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
 )
 
+// key used in UsersLastNotifiedTimestamps for the teams in which the user
+// has never been notified
+const userDefaultTeamKey = "*"
+
 type MANKVStore struct {
 	UserPreferences       map[string]model.MANUserPreferences
 	LastNotifiedTimestamp int64
+	// last notified timestamp of each user, per team (the key of the inner
+	// map is the team id, "" for the direct messages team)
+	UsersLastNotifiedTimestamps map[string]map[string]int64
+	// time of the last run in which each user has been processed
+	UsersLastProcessedTimestamps map[string]int64
+	// users with digests that could not be sent after the max number of
+	// attempts, with the time they have been flagged
+	FlaggedUsers map[string]int64
 }
 
 func (mm *MattermostBackend) GetLastNotifiedTimestamp() (time.Time, error) {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
 	store, err := mm.getKVStore()
 
 	if err != nil {
@@ -26,6 +42,9 @@ func (mm *MattermostBackend) GetLastNotifiedTimestamp() (time.Time, error) {
 }
 
 func (mm *MattermostBackend) SetLastNotifiedTimestamp(value time.Time) error {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
 	store, err := mm.getKVStore()
 
 	if err != nil {
@@ -42,7 +61,240 @@ func (mm *MattermostBackend) SetLastNotifiedTimestamp(value time.Time) error {
 	return nil
 }
 
+// returns the timestamp up to which the missed activity of the user in the team
+// has been notified. The second returned value is false if the user has never
+// been notified in the team.
+func (mm *MattermostBackend) GetUserLastNotifiedTimestamp(userID string, teamID string) (time.Time, bool, error) {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
+	store, err := mm.getKVStore()
+
+	if err != nil {
+		return time.Time{}, false, errors.Wrap(err, "Error getting kvStore in GetUserLastNotifiedTimestamp")
+	}
+
+	if teams, ok := store.UsersLastNotifiedTimestamps[userID]; ok {
+		if value, ok2 := teams[teamID]; ok2 {
+			return time.UnixMilli(value), true, nil
+		}
+		if value, ok2 := teams[userDefaultTeamKey]; ok2 {
+			return time.UnixMilli(value), true, nil
+		}
+	}
+
+	return time.Time{}, false, nil
+}
+
+// changes to the timestamps of the users made during a run. They are kept in
+// memory and saved together with the last notified timestamp at the end of
+// the run (see SaveRunTimestamps), so that the kvstore is written once per run
+// and the timestamps of the users are always consistent with the last
+// notified timestamp
+type RunTimestamps struct {
+	// per user and team
+	lastNotified map[string]map[string]time.Time
+	// users not notified in all their teams, with the timestamp to keep
+	kept map[string]time.Time
+	// users notified in all their teams
+	processed   []string
+	processedAt time.Time
+}
+
+func NewRunTimestamps() *RunTimestamps {
+	return &RunTimestamps{
+		lastNotified: map[string]map[string]time.Time{},
+		kept:         map[string]time.Time{},
+		processed:    []string{},
+	}
+}
+
+// sets the timestamp up to which the missed activity of the user in the team has been notified
+func (rt *RunTimestamps) SetUserLastNotified(userID string, teamID string, value time.Time) {
+	teams, ok := rt.lastNotified[userID]
+	if !ok {
+		teams = map[string]time.Time{}
+		rt.lastNotified[userID] = teams
+	}
+	teams[teamID] = value
+}
+
+// records the timestamp as the last notified timestamp of the user for the
+// teams in which the user has never been notified, unless one is already
+// recorded. It is used for users that have not been notified in this run
+// (e.g., not due, deferred or failed), so that their missed activity is not
+// considered notified when the global last notified timestamp advances
+func (rt *RunTimestamps) KeepUserLastNotified(userID string, value time.Time) {
+	rt.kept[userID] = value
+}
+
+// records the users notified in all their teams. The timestamps kept for
+// them in previous runs are not needed anymore
+func (rt *RunTimestamps) SetUsersProcessed(userIDs []string, value time.Time) {
+	rt.processed = append(rt.processed, userIDs...)
+	rt.processedAt = value
+}
+
+func (store *MANKVStore) applyRunTimestamps(rt *RunTimestamps, lastNotified time.Time) {
+	for userID, teams := range rt.lastNotified {
+		if _, ok := store.UsersLastNotifiedTimestamps[userID]; !ok {
+			store.UsersLastNotifiedTimestamps[userID] = map[string]int64{}
+		}
+		for teamID, value := range teams {
+			store.UsersLastNotifiedTimestamps[userID][teamID] = value.UnixMilli()
+		}
+	}
+
+	for _, userID := range rt.processed {
+		store.UsersLastProcessedTimestamps[userID] = rt.processedAt.UnixMilli()
+		delete(store.UsersLastNotifiedTimestamps[userID], userDefaultTeamKey)
+	}
+
+	for userID, value := range rt.kept {
+		teams, ok := store.UsersLastNotifiedTimestamps[userID]
+		if !ok {
+			teams = map[string]int64{}
+			store.UsersLastNotifiedTimestamps[userID] = teams
+		}
+		if _, ok2 := teams[userDefaultTeamKey]; !ok2 {
+			teams[userDefaultTeamKey] = value.UnixMilli()
+		}
+	}
+
+	store.LastNotifiedTimestamp = lastNotified.UnixMilli()
+}
+
+// saves the timestamps of the users changed in the run and the last
+// notified timestamp, with a single write of the kvstore
+func (mm *MattermostBackend) SaveRunTimestamps(rt *RunTimestamps, lastNotified time.Time) error {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
+	store, err := mm.getKVStore()
+
+	if err != nil {
+		return errors.Wrap(err, "Error getting kvStore while saving run timestamps")
+	}
+
+	store.applyRunTimestamps(rt, lastNotified)
+
+	err2 := mm.saveKV()
+	if err2 != nil {
+		return errors.Wrap(err2, "Error saving kvStore while saving run timestamps")
+	}
+
+	return nil
+}
+
+// returns the time of the last run in which the user has been processed. The
+// second returned value is false if the user has never been processed
+func (mm *MattermostBackend) GetUserLastProcessedTimestamp(userID string) (time.Time, bool, error) {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
+	store, err := mm.getKVStore()
+
+	if err != nil {
+		return time.Time{}, false, errors.Wrap(err, "Error getting kvStore in GetUserLastProcessedTimestamp")
+	}
+
+	if value, ok := store.UsersLastProcessedTimestamps[userID]; ok {
+		return time.UnixMilli(value), true, nil
+	}
+
+	return time.Time{}, false, nil
+}
+
+func (mm *MattermostBackend) SetUsersLastProcessedTimestamp(userIDs []string, value time.Time) error {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
+	store, err := mm.getKVStore()
+
+	if err != nil {
+		return errors.Wrap(err, "Error getting kvStore while setting user last processed timetamp")
+	}
+
+	for _, userID := range userIDs {
+		store.UsersLastProcessedTimestamps[userID] = value.UnixMilli()
+	}
+
+	err2 := mm.saveKV()
+	if err2 != nil {
+		return errors.Wrap(err2, "Error saving kvStore while setting user last processed timetamp")
+	}
+
+	return nil
+}
+
+// returns the flagged users with the time they have been flagged
+func (mm *MattermostBackend) GetFlaggedUsers() (map[string]time.Time, error) {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
+	store, err := mm.getKVStore()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting kvStore in GetFlaggedUsers")
+	}
+
+	res := map[string]time.Time{}
+	for userID, value := range store.FlaggedUsers {
+		res[userID] = time.UnixMilli(value)
+	}
+	return res, nil
+}
+
+// flags (or unflags, if flagged is false) the user
+func (mm *MattermostBackend) SetUserFlagged(userID string, flagged bool, value time.Time) error {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
+	store, err := mm.getKVStore()
+
+	if err != nil {
+		return errors.Wrap(err, "Error getting kvStore while flagging user")
+	}
+
+	if flagged {
+		store.FlaggedUsers[userID] = value.UnixMilli()
+	} else {
+		delete(store.FlaggedUsers, userID)
+	}
+
+	err2 := mm.saveKV()
+	if err2 != nil {
+		return errors.Wrap(err2, "Error saving kvStore while flagging user")
+	}
+
+	return nil
+}
+
+func (mm *MattermostBackend) ResetUsersLastNotifiedTimestamps() error {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
+	store, err := mm.getKVStore()
+
+	if err != nil {
+		return errors.Wrap(err, "Error getting kvStore while resetting users last notified timetamps")
+	}
+
+	store.UsersLastNotifiedTimestamps = map[string]map[string]int64{}
+	store.UsersLastProcessedTimestamps = map[string]int64{}
+
+	err2 := mm.saveKV()
+	if err2 != nil {
+		return errors.Wrap(err2, "Error saving kvStore while resetting users last notified timetamps")
+	}
+
+	return nil
+}
+
 func (mm *MattermostBackend) ResetAllUserPrefernces() error {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
 	pref, err := mm.getKVStore()
 
 	if err != nil {
@@ -63,6 +315,9 @@ func (mm *MattermostBackend) ResetAllUserPrefernces() error {
 }
 
 func (mm *MattermostBackend) ResetPreferences(user *model.User) error {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
 	pref, err := mm.getKVStore()
 
 	if err != nil {
@@ -80,29 +335,45 @@ func (mm *MattermostBackend) ResetPreferences(user *model.User) error {
 	return nil
 }
 
+// returns a copy of the preferences of the user, that can be modified
+// without affecting the stored ones
 func (mm *MattermostBackend) GetPreferencesForUser(userID string) model.MANUserPreferences {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
+	return mm.getPreferencesForUser(userID)
+}
+
+func (mm *MattermostBackend) getPreferencesForUser(userID string) model.MANUserPreferences {
 	// load MAN preferences
 	prefs, kvErr := mm.getKVStore()
 	if kvErr != nil {
 		mm.LogError("error loading MAN Preferences for user %s: %s", userID, kvErr)
+		return mm.defaultUserPrefs.Copy()
 	}
 
 	if entry, ok := prefs.UserPreferences[userID]; ok {
-		return entry
+		return entry.Copy()
 	}
 
-	defaultCopy := *mm.defaultUserPrefs
-	return defaultCopy
+	return mm.defaultUserPrefs.Copy()
 }
 
 func (mm *MattermostBackend) SetPreferencesForUser(userID string, prefs model.MANUserPreferences) error {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
+	return mm.setPreferencesForUser(userID, prefs)
+}
+
+func (mm *MattermostBackend) setPreferencesForUser(userID string, prefs model.MANUserPreferences) error {
 	// load MAN preferences
 	store, kvErr := mm.getKVStore()
 	if kvErr != nil {
-		mm.LogError("error loading MAN Preferences for user %s: %s", userID, kvErr)
+		return errors.Wrap(kvErr, "error loading kvstore")
 	}
 
-	store.UserPreferences[userID] = prefs
+	store.UserPreferences[userID] = prefs.Copy()
 	errS := mm.saveKV()
 	if errS != nil {
 		return errors.Wrap(errS, "error saving kvstore")
@@ -111,27 +382,38 @@ func (mm *MattermostBackend) SetPreferencesForUser(userID string, prefs model.MA
 	return nil
 }
 
+// reads, updates and saves the preferences of the user holding the lock,
+// so that concurrent updates (e.g., a command and an email link) are not
+// lost. The preferences are not saved if update returns an error or does
+// not change them, so users without preferences keep following the defaults
+func (mm *MattermostBackend) UpdatePreferencesForUser(userID string, update func(prefs *model.MANUserPreferences) error) error {
+	mm.kvStoreLock.Lock()
+	defer mm.kvStoreLock.Unlock()
+
+	current := mm.getPreferencesForUser(userID)
+	prefs := current.Copy()
+	if err := update(&prefs); err != nil {
+		return err
+	}
+	if reflect.DeepEqual(current, prefs) {
+		return nil
+	}
+	return mm.setPreferencesForUser(userID, prefs)
+}
+
 func (mm *MattermostBackend) SetUserPreference(user *model.User, name string, newValue any) error {
-	prefs := mm.GetPreferencesForUser(user.ID)
-
-	has, _ := reflections.HasField(prefs, name)
-
-	if has {
-		currentValue, _ := reflections.GetField(prefs, name)
-		if currentValue != newValue {
-			errF := reflections.SetField(&prefs, name, newValue)
-			if errF != nil {
-				return errors.Wrap(errF, "error setting preference value for user")
-			}
-			errS := mm.SetPreferencesForUser(user.ID, prefs)
-			if errS != nil {
-				return errors.Wrap(errS, "error savling preferences for user")
-			}
+	return mm.UpdatePreferencesForUser(user.ID, func(prefs *model.MANUserPreferences) error {
+		if has, _ := reflections.HasField(*prefs, name); !has {
+			return nil
 		}
-	}
-	return nil
+		if errF := reflections.SetField(prefs, name, newValue); errF != nil {
+			return errors.Wrap(errF, "error setting preference value for user")
+		}
+		return nil
+	})
 }
 
+// saveKV and getKVStore must be called holding kvStoreLock
 func (mm *MattermostBackend) saveKV() error {
 	ser, errSer := json.Marshal(mm.kvStoreCache)
 
@@ -161,8 +443,11 @@ func (mm *MattermostBackend) getKVStore() (*MANKVStore, error) {
 	// key does not exist
 	if bytes == nil {
 		mm.kvStoreCache = &MANKVStore{
-			UserPreferences:       map[string]model.MANUserPreferences{},
-			LastNotifiedTimestamp: 0,
+			UserPreferences:              map[string]model.MANUserPreferences{},
+			LastNotifiedTimestamp:        0,
+			UsersLastNotifiedTimestamps:  map[string]map[string]int64{},
+			UsersLastProcessedTimestamps: map[string]int64{},
+			FlaggedUsers:                 map[string]int64{},
 		}
 		errS := mm.saveKV()
 		if errS != nil {
@@ -176,6 +461,18 @@ func (mm *MattermostBackend) getKVStore() (*MANKVStore, error) {
 		return nil, errors.Wrap(err, "Error unseralizing kvStore")
 	}
 
+	// stores saved by previous versions of the plugin do not have
+	// per-user timestamps
+	if store.UsersLastNotifiedTimestamps == nil {
+		store.UsersLastNotifiedTimestamps = map[string]map[string]int64{}
+	}
+	if store.UsersLastProcessedTimestamps == nil {
+		store.UsersLastProcessedTimestamps = map[string]int64{}
+	}
+	if store.FlaggedUsers == nil {
+		store.FlaggedUsers = map[string]int64{}
+	}
+
 	mm.kvStoreCache = &store
 
 	return mm.kvStoreCache, nil
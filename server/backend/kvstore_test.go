@@ -0,0 +1,141 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	mm_model "github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plugin API keeping the kv store in memory. Methods not implemented here
+// panic, since the embedded interface is nil
+type kvStoreAPI struct {
+	plugin.API
+	kv   map[string][]byte
+	sets int
+}
+
+func (a *kvStoreAPI) KVGet(key string) ([]byte, *mm_model.AppError) {
+	return a.kv[key], nil
+}
+
+func (a *kvStoreAPI) KVSet(key string, value []byte) *mm_model.AppError {
+	a.kv[key] = value
+	a.sets++
+	return nil
+}
+
+func (a *kvStoreAPI) LogInfo(msg string, keyValuePairs ...any) {}
+
+func TestUserLastNotifiedTimestamps(t *testing.T) {
+	api := &kvStoreAPI{kv: map[string][]byte{}}
+	mm, err := NewMattermostBackend(api, nil, 1, false, nil)
+	require.NoError(t, err)
+
+	t1 := time.UnixMilli(1000)
+	t2 := time.UnixMilli(2000)
+	t3 := time.UnixMilli(3000)
+
+	_, found, err := mm.GetUserLastNotifiedTimestamp("user1", "team1")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// per-team watermarks, saved with a single write
+	run := NewRunTimestamps()
+	run.SetUserLastNotified("user1", "team1", t1)
+	run.SetUserLastNotified("user1", "team2", t2)
+	run.SetUserLastNotified("user2", "team1", t2)
+	sets := api.sets
+	require.NoError(t, mm.SaveRunTimestamps(run, t2))
+	assert.Equal(t, sets+1, api.sets)
+
+	value, found, _ := mm.GetUserLastNotifiedTimestamp("user1", "team1")
+	assert.True(t, found)
+	assert.Equal(t, t1, value)
+	value, _, _ = mm.GetUserLastNotifiedTimestamp("user1", "team2")
+	assert.Equal(t, t2, value)
+	_, found, _ = mm.GetUserLastNotifiedTimestamp("user1", "team3")
+	assert.False(t, found)
+	_, found, _ = mm.GetUserLastNotifiedTimestamp("user3", "team1")
+	assert.False(t, found)
+	value, _ = mm.GetLastNotifiedTimestamp()
+	assert.Equal(t, t2, value)
+
+	// a run updates only the teams it sets
+	run = NewRunTimestamps()
+	run.SetUserLastNotified("user1", "team1", t3)
+	require.NoError(t, mm.SaveRunTimestamps(run, t3))
+	value, _, _ = mm.GetUserLastNotifiedTimestamp("user1", "team1")
+	assert.Equal(t, t3, value)
+	value, _, _ = mm.GetUserLastNotifiedTimestamp("user1", "team2")
+	assert.Equal(t, t2, value)
+
+	// the kept timestamp is the fallback for the teams without a watermark
+	run = NewRunTimestamps()
+	run.KeepUserLastNotified("user1", t2)
+	require.NoError(t, mm.SaveRunTimestamps(run, t3))
+	value, found, _ = mm.GetUserLastNotifiedTimestamp("user1", "team3")
+	assert.True(t, found)
+	assert.Equal(t, t2, value)
+	value, _, _ = mm.GetUserLastNotifiedTimestamp("user1", "team1")
+	assert.Equal(t, t3, value)
+
+	// an already kept timestamp is not overwritten
+	run = NewRunTimestamps()
+	run.KeepUserLastNotified("user1", t3)
+	require.NoError(t, mm.SaveRunTimestamps(run, t3))
+	value, _, _ = mm.GetUserLastNotifiedTimestamp("user1", "team3")
+	assert.Equal(t, t2, value)
+
+	// the timestamps survive a reload of the kv store
+	mm.kvStoreCache = nil
+	value, _, _ = mm.GetUserLastNotifiedTimestamp("user1", "team1")
+	assert.Equal(t, t3, value)
+	value, _, _ = mm.GetUserLastNotifiedTimestamp("user1", "team2")
+	assert.Equal(t, t2, value)
+	value, _, _ = mm.GetUserLastNotifiedTimestamp("user1", "team3")
+	assert.Equal(t, t2, value)
+
+	// processing the user removes the fallback, but not the watermarks
+	run = NewRunTimestamps()
+	run.SetUsersProcessed([]string{"user1"}, t3)
+	require.NoError(t, mm.SaveRunTimestamps(run, t3))
+	_, found, _ = mm.GetUserLastNotifiedTimestamp("user1", "team3")
+	assert.False(t, found)
+	value, _, _ = mm.GetUserLastNotifiedTimestamp("user1", "team1")
+	assert.Equal(t, t3, value)
+	value, found, _ = mm.GetUserLastProcessedTimestamp("user1")
+	assert.True(t, found)
+	assert.Equal(t, t3, value)
+}
+
+// a user not due (or deferred) for two runs still gets the posts created
+// before the first of them in the next run
+func TestSkippedUserKeepsLastNotifiedTimestamp(t *testing.T) {
+	api := &kvStoreAPI{kv: map[string][]byte{}}
+	mm, err := NewMattermostBackend(api, nil, 1, false, nil)
+	require.NoError(t, err)
+
+	t0 := time.UnixMilli(1000)
+	require.NoError(t, mm.SaveRunTimestamps(NewRunTimestamps(), t0))
+
+	for _, upper := range []time.Time{time.UnixMilli(2000), time.UnixMilli(3000)} {
+		previous, _ := mm.GetLastNotifiedTimestamp()
+		run := NewRunTimestamps()
+		run.KeepUserLastNotified("user1", previous)
+		require.NoError(t, mm.SaveRunTimestamps(run, upper))
+	}
+
+	// a post created before the first skipped run is not considered notified
+	post := time.UnixMilli(1500)
+	value, found, _ := mm.GetUserLastNotifiedTimestamp("user1", "team1")
+	assert.True(t, found)
+	assert.Equal(t, t0, value)
+	assert.True(t, post.After(value))
+
+	global, _ := mm.GetLastNotifiedTimestamp()
+	assert.False(t, post.After(global))
+}
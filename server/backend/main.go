@@ -3,8 +3,11 @@ package backend
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	mm_model "github.com/mattermost/mattermost/server/public/model"
@@ -14,6 +17,9 @@ import (
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
 )
 
+// id of the plugin, as in plugin.json
+const PluginID = "com.mattermost.missed-activity-notifier"
+
 type MattermostBackend struct {
 	api           plugin.API
 	db            *sql.DB
@@ -31,11 +37,22 @@ type MattermostBackend struct {
 	channelsCache *cache.Cache
 
 	// object stored in the Mattermost kvstore. We keep a copy
-	// in memory for reads (since we are the only ones to modify it)
+	// in memory for reads (since we are the only ones to modify it).
+	// The lock protects it, since users are processed concurrently
 	kvStoreCache *MANKVStore
+	kvStoreLock  sync.Mutex
 
 	// 30 seconds cache for user statuses
 	userStatusCache *cache.Cache
+
+	// user id of the bot that sends digests as direct messages
+	botUserID string
+
+	// key used to sign the action links, loaded from the kvstore
+	actionKey     []byte
+	actionKeyLock sync.Mutex
+	// protects the action audit log, updated from concurrent http requests
+	actionAuditLock sync.Mutex
 }
 
 func CreateTeam(mmTeam *mm_model.Team) *model.Team {
@@ -123,6 +140,20 @@ func (mm *MattermostBackend) GetServerURL() string {
 	return "http://localhost/"
 }
 
+// returns the base url of the plugin http endpoints
+func (mm *MattermostBackend) GetPluginURL() string {
+	return strings.TrimSuffix(mm.GetServerURL(), "/") + "/plugins/" + PluginID
+}
+
+// returns the host name of the server, used to build the ids of the emails
+func (mm *MattermostBackend) GetServerHostname() string {
+	u, err := url.Parse(mm.GetServerURL())
+	if err != nil || u.Hostname() == "" {
+		return "localhost"
+	}
+	return u.Hostname()
+}
+
 func (mm *MattermostBackend) IsEmailVerificationEnabled() bool {
 	value := mm.api.GetConfig().EmailSettings.RequireEmailVerification
 	if value != nil {
@@ -130,3 +161,46 @@ func (mm *MattermostBackend) IsEmailVerificationEnabled() bool {
 	}
 	return false
 }
+
+// returns the placeholder for the n-th parameter of a query (starting from 1),
+// according to the database used by Mattermost
+func (mm *MattermostBackend) sqlPlaceholder(n int) string {
+	driver := mm.api.GetConfig().SqlSettings.DriverName
+	if driver != nil && *driver == mm_model.DatabaseDriverMysql {
+		return "?"
+	}
+	return fmt.Sprintf("$%d", n)
+}
+
+// returns the server setting for Collapsed Reply Threads (disabled, default_on, default_off, always_on)
+func (mm *MattermostBackend) GetCollapsedThreadsSetting() string {
+	value := mm.api.GetConfig().ServiceSettings.CollapsedThreads
+	if value != nil {
+		return *value
+	}
+	return mm_model.CollapsedThreadsDisabled
+}
+
+func (mm *MattermostBackend) IsSendEmailNotificationsEnabled() bool {
+	value := mm.api.GetConfig().EmailSettings.SendEmailNotifications
+	if value != nil {
+		return *value
+	}
+	return false
+}
+
+func (mm *MattermostBackend) IsEmailBatchingEnabled() bool {
+	value := mm.api.GetConfig().EmailSettings.EnableEmailBatching
+	if value != nil {
+		return *value
+	}
+	return false
+}
+
+func (mm *MattermostBackend) IsSendPushNotificationsEnabled() bool {
+	value := mm.api.GetConfig().EmailSettings.SendPushNotifications
+	if value != nil {
+		return *value
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package backend
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+// each outbox entry is stored in its own key, so that rendered digests
+// do not end up in the kvstore object
+const outboxKeyPrefix = "outbox_"
+
+const kvListPageSize = 100
+
+func (mm *MattermostBackend) SaveOutboxEntry(entry *model.OutboxEntry) error {
+	ser, errSer := json.Marshal(entry)
+	if errSer != nil {
+		return errors.Wrap(errSer, "Error serializing outbox entry")
+	}
+
+	errSet := mm.api.KVSet(outboxKeyPrefix+entry.ID, ser)
+	if errSet != nil {
+		return errors.Wrap(errSet, "Error saving outbox entry")
+	}
+	return nil
+}
+
+func (mm *MattermostBackend) DeleteOutboxEntry(id string) error {
+	errDel := mm.api.KVDelete(outboxKeyPrefix + id)
+	if errDel != nil {
+		return errors.Wrap(errDel, "Error deleting outbox entry")
+	}
+	return nil
+}
+
+// returns all the entries in the outbox, from the oldest to the newest
+func (mm *MattermostBackend) GetOutboxEntries() ([]*model.OutboxEntry, error) {
+	keys := []string{}
+	for page := 0; ; page++ {
+		pageKeys, errL := mm.api.KVList(page, kvListPageSize)
+		if errL != nil {
+			return nil, errors.Wrap(errL, "Error listing kvstore keys")
+		}
+		for _, k := range pageKeys {
+			if strings.HasPrefix(k, outboxKeyPrefix) {
+				keys = append(keys, k)
+			}
+		}
+		if len(pageKeys) < kvListPageSize {
+			break
+		}
+	}
+
+	res := []*model.OutboxEntry{}
+	for _, k := range keys {
+		bytes, errG := mm.api.KVGet(k)
+		if errG != nil {
+			return nil, errors.Wrap(errG, "Error getting outbox entry")
+		}
+		// deleted in the meantime
+		if bytes == nil {
+			continue
+		}
+
+		var entry model.OutboxEntry
+		if err := json.Unmarshal(bytes, &entry); err != nil {
+			return nil, errors.Wrap(err, "Error unserializing outbox entry")
+		}
+		res = append(res, &entry)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt < res[j].CreatedAt
+	})
+
+	return res, nil
+}
@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+const channelPoliciesKey = "channel_policies"
+
+// returns the channel policies set by the administrators, in the order they
+// have been added
+func (mm *MattermostBackend) GetChannelPolicies() (model.ChannelPolicies, error) {
+	bytes, errG := mm.api.KVGet(channelPoliciesKey)
+	if errG != nil {
+		return nil, errors.Wrap(errG, "Error getting channel policies")
+	}
+
+	policies := model.ChannelPolicies{}
+	if bytes == nil {
+		return policies, nil
+	}
+	if err := json.Unmarshal(bytes, &policies); err != nil {
+		return nil, errors.Wrap(err, "Error unserializing channel policies")
+	}
+	return policies, nil
+}
+
+func (mm *MattermostBackend) SaveChannelPolicies(policies model.ChannelPolicies) error {
+	ser, errSer := json.Marshal(policies)
+	if errSer != nil {
+		return errors.Wrap(errSer, "Error serializing channel policies")
+	}
+
+	if errSet := mm.api.KVSet(channelPoliciesKey, ser); errSet != nil {
+		return errors.Wrap(errSet, "Error saving channel policies")
+	}
+	return nil
+}
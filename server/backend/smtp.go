@@ -0,0 +1,68 @@
+package backend
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/mail"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+func stringValue(value *string) string {
+	if value != nil {
+		return *value
+	}
+	return ""
+}
+
+// returns the smtp settings configured in Mattermost. The unsanitized config
+// is needed to read the smtp password
+func (mm *MattermostBackend) getSMTPSettings() (*mail.SMTPSettings, error) {
+	settings := mm.api.GetUnsanitizedConfig().EmailSettings
+
+	if stringValue(settings.SMTPServer) == "" {
+		return nil, errors.New("smtp server not configured in Mattermost")
+	}
+
+	res := &mail.SMTPSettings{
+		Server:             stringValue(settings.SMTPServer),
+		Port:               stringValue(settings.SMTPPort),
+		ConnectionSecurity: stringValue(settings.ConnectionSecurity),
+		Auth:               settings.EnableSMTPAuth != nil && *settings.EnableSMTPAuth,
+		Username:           stringValue(settings.SMTPUsername),
+		Password:           stringValue(settings.SMTPPassword),
+		SkipCertVerify:     settings.SkipServerCertificateVerification != nil && *settings.SkipServerCertificateVerification,
+		Timeout:            10 * time.Second,
+	}
+	if settings.SMTPServerTimeout != nil && *settings.SMTPServerTimeout > 0 {
+		res.Timeout = time.Duration(*settings.SMTPServerTimeout) * time.Second
+	}
+	return res, nil
+}
+
+// sends an email with the smtp server configured in Mattermost (the plugin
+// API can send only html emails). Sender and recipient are set from the
+// Mattermost settings and the user
+func (mm *MattermostBackend) SendMIMEEmailToUser(user *model.User, msg *mail.Message) error {
+	smtpSettings, err := mm.getSMTPSettings()
+	if err != nil {
+		return err
+	}
+
+	emailSettings := mm.api.GetConfig().EmailSettings
+	msg.FromName = stringValue(emailSettings.FeedbackName)
+	msg.FromAddress = stringValue(emailSettings.FeedbackEmail)
+	msg.To = user.Email
+	if msg.Headers == nil {
+		msg.Headers = map[string]string{}
+	}
+	if replyTo := stringValue(emailSettings.ReplyToAddress); replyTo != "" {
+		msg.Headers["Reply-To"] = replyTo
+	}
+
+	if err := mail.Send(smtpSettings, msg); err != nil {
+		return errors.Wrap(err, "error sending email")
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+// the custom templates are stored in their own keys, since they can be big.
+// The draft is edited and previewed by the administrators, the published
+// version is used to send emails
+const (
+	templatesDraftKey     = "templates_draft"
+	templatesPublishedKey = "templates_published"
+)
+
+func templatesKey(draft bool) string {
+	if draft {
+		return templatesDraftKey
+	}
+	return templatesPublishedKey
+}
+
+// returns the custom email templates, nil if they have not been saved
+func (mm *MattermostBackend) GetEmailTemplates(draft bool) (*model.EmailTemplates, error) {
+	bytes, errG := mm.api.KVGet(templatesKey(draft))
+	if errG != nil {
+		return nil, errors.Wrap(errG, "Error getting email templates")
+	}
+	if bytes == nil {
+		return nil, nil
+	}
+
+	var res model.EmailTemplates
+	if err := json.Unmarshal(bytes, &res); err != nil {
+		return nil, errors.Wrap(err, "Error unserializing email templates")
+	}
+	return &res, nil
+}
+
+func (mm *MattermostBackend) SaveEmailTemplates(draft bool, templates *model.EmailTemplates) error {
+	ser, errSer := json.Marshal(templates)
+	if errSer != nil {
+		return errors.Wrap(errSer, "Error serializing email templates")
+	}
+
+	if errSet := mm.api.KVSet(templatesKey(draft), ser); errSet != nil {
+		return errors.Wrap(errSet, "Error saving email templates")
+	}
+	return nil
+}
+
+func (mm *MattermostBackend) DeleteEmailTemplates(draft bool) error {
+	if errDel := mm.api.KVDelete(templatesKey(draft)); errDel != nil {
+		return errors.Wrap(errDel, "Error deleting email templates")
+	}
+	return nil
+}
@@ -3,11 +3,15 @@ package backend
 import (
 	"fmt"
 	"math/rand"
+	"strconv"
+	"strings"
+	"time"
 
 	mm_model "github.com/mattermost/mattermost/server/public/model"
 	"github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
 
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/i18n"
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
 )
 
@@ -45,21 +49,41 @@ func (mm *MattermostBackend) GetUser(userID string) (*model.User, error) {
 	return nil, fmt.Errorf("user not found (userId=%s)", userID)
 }
 
-func (mm *MattermostBackend) IsUserFollowingPost(postID string, userID string) bool {
-	rows, err := mm.db.Query(fmt.Sprintf("SELECT Following FROM ThreadMemberships WHERE PostId = '%s' AND UserId = '%s'", postID, userID))
+func (mm *MattermostBackend) GetUserByUsername(username string) (*model.User, error) {
+	u, err := mm.api.GetUserByUsername(username)
 	if err != nil {
-		mm.api.LogError(fmt.Sprintf("Error querying db for threads following: %s", err))
+		return nil, fmt.Errorf("error getting user by username: %s", err)
+	}
+	return mm.GetUser(u.Id)
+}
+
+// returns the thread memberships of the user for the threads in the channel,
+// indexed by root post ID. All memberships are loaded with a single query
+func (mm *MattermostBackend) GetThreadMemberships(channelID string, userID string) (map[string]*model.ThreadMembership, error) {
+	query := fmt.Sprintf("SELECT tm.PostId, tm.Following, tm.LastViewed, COALESCE(t.LastReplyAt, 0) FROM ThreadMemberships tm INNER JOIN Posts p ON p.Id = tm.PostId LEFT JOIN Threads t ON t.PostId = tm.PostId WHERE p.ChannelId = %s AND tm.UserId = %s", mm.sqlPlaceholder(1), mm.sqlPlaceholder(2))
+
+	rows, err := mm.db.Query(query, channelID, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error querying db for thread memberships")
 	}
 	defer rows.Close()
 
-	if rows.Next() { // assuming exactly one result
-		var following int8
-		if err2 := rows.Scan(&following); err2 != nil {
-			mm.api.LogError(fmt.Sprintf("Error scanning rows: %s", err2))
+	res := map[string]*model.ThreadMembership{}
+	for rows.Next() {
+		var postID string
+		var following bool
+		var lastViewed, lastReplyAt int64
+		if err2 := rows.Scan(&postID, &following, &lastViewed, &lastReplyAt); err2 != nil {
+			return nil, errors.Wrap(err2, "error scanning rows")
+		}
+		res[postID] = &model.ThreadMembership{
+			PostID:      postID,
+			Following:   following,
+			LastViewed:  time.UnixMilli(lastViewed),
+			LastReplyAt: time.UnixMilli(lastReplyAt),
 		}
-		return following > 0
 	}
-	return false
+	return res, rows.Err()
 }
 
 func (mm *MattermostBackend) GetNotifiableUsers() ([]*model.User, error) {
@@ -74,10 +98,11 @@ func (mm *MattermostBackend) GetNotifiableUsers() ([]*model.User, error) {
 
 	// filter users
 	for _, u := range users {
+		// users that disabled Mattermost emails are not excluded: the
+		// plugin can be disabled with its own preference
 		if u.IsBot ||
 			!u.MANPreferences.Enabled ||
-			(!u.EmailVerified && emailVerificationEnabled) ||
-			!u.EmailsEnabled {
+			(!u.EmailVerified && emailVerificationEnabled) {
 			continue
 		}
 		res = append(res, u)
@@ -128,6 +153,111 @@ func (mm *MattermostBackend) GetUsersStatus() (map[string]string, error) {
 	return userStatuses, nil
 }
 
+// returns the Mattermost preferences of the user indexed by "category/name".
+// Preferences the user never changed are not included
+func (mm *MattermostBackend) getMattermostPreferences(userID string) map[string]string {
+	res := map[string]string{}
+
+	prefs, err := mm.api.GetPreferencesForUser(userID)
+	if err != nil {
+		mm.LogWarn("Error getting preferences for user %s: %s", userID, err.Error())
+		return res
+	}
+
+	for _, p := range prefs {
+		res[p.Category+"/"+p.Name] = p.Value
+	}
+	return res
+}
+
+// returns the interval chosen by the user for Mattermost batched emails, 0 if not set
+func (mm *MattermostBackend) getEmailInterval(userID string, prefs map[string]string) time.Duration {
+	value := prefs[mm_model.PreferenceCategoryNotifications+"/"+mm_model.PreferenceNameEmailInterval]
+
+	switch value {
+	case "":
+		return 0
+	case mm_model.PreferenceEmailIntervalImmediately:
+		return 30 * time.Second
+	case mm_model.PreferenceEmailIntervalFifteen:
+		return 15 * time.Minute
+	case mm_model.PreferenceEmailIntervalHour:
+		return time.Hour
+	}
+
+	seconds, errC := strconv.Atoi(value)
+	if errC != nil {
+		mm.LogWarn("Invalid email interval '%s' for user %s", value, userID)
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// returns true if the user reads replies in the Threads view (Collapsed Reply
+// Threads), according to the server configuration and the user's display settings
+func (mm *MattermostBackend) isCollapsedThreadsEnabled(prefs map[string]string) bool {
+	serverSetting := mm.GetCollapsedThreadsSetting()
+
+	switch serverSetting {
+	case mm_model.CollapsedThreadsDisabled:
+		return false
+	case mm_model.CollapsedThreadsAlwaysOn:
+		return true
+	}
+
+	if value, ok := prefs[mm_model.PreferenceCategoryDisplaySettings+"/"+mm_model.PreferenceNameCollapsedThreadsEnabled]; ok {
+		return value == "on"
+	}
+	return serverSetting == mm_model.CollapsedThreadsDefaultOn
+}
+
+// returns the language of the user, or the default language of the server if
+// the user did not choose one
+func (mm *MattermostBackend) getUserLocale(u *mm_model.User) string {
+	if u.Locale != "" {
+		return u.Locale
+	}
+	value := mm.api.GetConfig().LocalizationSettings.DefaultClientLocale
+	if value != nil {
+		return *value
+	}
+	return i18n.DefaultLocale
+}
+
+// builds the mention keys of the user from the Mattermost notification settings and the groups of the user
+func (mm *MattermostBackend) buildMentionKeys(u *mm_model.User) model.MentionKeys {
+	keys := model.MentionKeys{
+		Username:        u.Username,
+		Keys:            []string{},
+		Groups:          []string{},
+		ChannelMentions: u.NotifyProps[mm_model.ChannelMentionsNotifyProp] == "true",
+	}
+
+	if u.NotifyProps[mm_model.FirstNameNotifyProp] == "true" {
+		keys.FirstName = u.FirstName
+	}
+
+	for _, k := range strings.Split(u.NotifyProps[mm_model.MentionKeysNotifyProp], ",") {
+		k = strings.TrimSpace(k)
+		// the username is always a mention key, no need to add it again
+		if k != "" && k != u.Username && k != "@"+u.Username {
+			keys.Keys = append(keys.Keys, k)
+		}
+	}
+
+	groups, errG := mm.api.GetGroupsForUser(u.Id)
+	if errG != nil {
+		mm.LogError("Error getting groups for user %s: %s", u.Username, errG)
+	}
+	for _, g := range groups {
+		if g.AllowReference && g.Name != nil && g.DeleteAt == 0 {
+			keys.Groups = append(keys.Groups, *g.Name)
+		}
+	}
+
+	return keys
+}
+
 func (mm *MattermostBackend) loadUsers(userID string) ([]*model.User, error) {
 	var mmUsers []*mm_model.User
 
@@ -171,6 +301,8 @@ func (mm *MattermostBackend) loadUsers(userID string) ([]*model.User, error) {
 			IsBot:         u.IsBot,
 			Roles:         u.GetRoles(),
 			Status:        userStatuses[u.Id],
+			Timezone:      u.GetPreferredTimezone(),
+			Locale:        mm.getUserLocale(u),
 			//nolint:gosec
 			AltText: usersAltText[rand.Intn(len(usersAltText))],
 		}
@@ -183,6 +315,13 @@ func (mm *MattermostBackend) loadUsers(userID string) ([]*model.User, error) {
 			newU.Image = profileImage
 		}
 
+		newU.MentionKeys = mm.buildMentionKeys(u)
+		newU.NotifyProps = u.NotifyProps
+		mmPrefs := mm.getMattermostPreferences(u.Id)
+		newU.EmailInterval = mm.getEmailInterval(u.Id, mmPrefs)
+		newU.CollapsedThreads = mm.isCollapsedThreadsEnabled(mmPrefs)
+		newU.UseMilitaryTime = mmPrefs[mm_model.PreferenceCategoryDisplaySettings+"/"+mm_model.PreferenceNameUseMilitaryTime] == "true"
+
 		// load MAN preferences
 		newU.MANPreferences = mm.GetPreferencesForUser(newU.ID)
 
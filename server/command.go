@@ -3,15 +3,21 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	mm_model "github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
 	"github.com/oleiade/reflections"
 	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
 
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/backend"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/delivery"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/i18n"
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/output"
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/userstatus"
@@ -19,12 +25,111 @@ import (
 
 const CommandTrigger = "missedactivity"
 
+// plugin route that lists the channels of the user for the autocomplete
+const channelsAutocompletePath = "/autocomplete/channels"
+
+func getAutocompleteData() *mm_model.AutocompleteData {
+	root := mm_model.NewAutocompleteData(CommandTrigger, "[command]", "Configure the Missed Activity Plugin")
+
+	commands := []struct{ trigger, hint, help string }{
+		{"help", "", "Show the help"},
+		{"prefs", "[show|reset|<name> <value>]", "Show or change your preferences"},
+		{"schedule", "[<schedule>|clear]", "Choose when to receive notifications"},
+		{"pause", "[<duration>|until <date>]", "Pause the notifications"},
+		{"resume", "", "Resume the notifications"},
+		{"quiethours", "[<from>-<to>|clear]", "Set the quiet hours"},
+		{"keywords", "[list|add|remove|clear]", "Manage your keywords"},
+		{"delivery", "[email|bot]", "Choose how to receive the digests"},
+	}
+	for _, c := range commands {
+		root.AddCommand(mm_model.NewAutocompleteData(c.trigger, c.hint, c.help))
+	}
+
+	channel := mm_model.NewAutocompleteData("channel", "[list|exclude|include|reset] [~channel]", "Choose which channels are notified")
+	channel.AddCommand(mm_model.NewAutocompleteData("list", "", "Show the excluded and included channels"))
+	for _, c := range []struct{ trigger, help string }{
+		{model.ChannelExclude, "Never notify the messages of the channel"},
+		{model.ChannelInclude, "Notify the messages of the channel, even if muted"},
+		{model.ChannelReset, "Notify the channel according to its notification preferences"},
+	} {
+		sub := mm_model.NewAutocompleteData(c.trigger, "[~channel]", c.help)
+		sub.AddDynamicListArgument("Channel (the current one if empty)", strings.TrimPrefix(channelsAutocompletePath, "/"), false)
+		channel.AddCommand(sub)
+	}
+	root.AddCommand(channel)
+
+	team := mm_model.NewAutocompleteData("team", "[list|enable|disable|set|reset|merge]", "Choose how each team is notified")
+	for _, c := range []struct{ trigger, hint, help string }{
+		{"list", "", "Show the settings of the teams"},
+		{"enable", "[team|direct]", "Notify the missed activity in the team (the current one if empty)"},
+		{"disable", "[team|direct]", "Do not notify the missed activity in the team (the current one if empty)"},
+		{"set", "<preference> <true|false> [team|direct]", "Override a preference in the team"},
+		{"reset", "[team|direct]", "Use the global preferences in the team"},
+		{"merge", "<true|false>", "Receive a single digest for all the teams"},
+	} {
+		team.AddCommand(mm_model.NewAutocompleteData(c.trigger, c.hint, c.help))
+	}
+	root.AddCommand(team)
+
+	for _, c := range []struct{ trigger, hint, help string }{
+		{"stats", "", "Show the stats of the last runs"},
+		{"outbox", "[list|retry <id|all>|delete <id|all>]", "Manage the emails that could not be sent"},
+		{"audit", "", "Show the actions executed from the email links"},
+		{"policy", "[list|add <always|never> <channel> [team]|remove <n>|show @user]", "Manage the channels always or never notified"},
+	} {
+		admin := mm_model.NewAutocompleteData(c.trigger, c.hint, c.help)
+		admin.RoleID = mm_model.SystemAdminRoleId
+		root.AddCommand(admin)
+	}
+
+	return root
+}
+
+// lists the channels of the user in the team, for the autocomplete of the channel command
+func (p *MANPlugin) serveChannelsAutocomplete(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		writeJSONError(w, http.StatusUnauthorized, "not authorized")
+		return
+	}
+
+	// the team comes from the request, so only teams of the user are listed
+	teamID := r.URL.Query().Get("team_id")
+	teams, errT := p.backend.GetTeamsForUser(userID)
+	if errT != nil {
+		p.backend.LogError("Error getting the teams of user %s: %s", userID, errT)
+		writeJSONError(w, http.StatusInternalServerError, "error getting teams")
+		return
+	}
+	if !slices.ContainsFunc(teams, func(t *model.Team) bool { return t.ID == teamID }) {
+		writeJSONError(w, http.StatusForbidden, "not a member of the team")
+		return
+	}
+
+	memberships, err := p.backend.GetChannelMembersForUser(teamID, userID, false)
+	if err != nil {
+		p.backend.LogError("Error getting the channels of user %s: %s", userID, err)
+		writeJSONError(w, http.StatusInternalServerError, "error getting channels")
+		return
+	}
+
+	items := []mm_model.AutocompleteListItem{}
+	for _, m := range memberships {
+		items = append(items, mm_model.AutocompleteListItem{Item: "~" + m.Channel.Name, HelpText: m.Channel.DisplayName})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Item < items[j].Item
+	})
+	writeJSON(w, http.StatusOK, items)
+}
+
 func (p *MANPlugin) registerMANCommand() error {
 	if err := p.API.RegisterCommand(&mm_model.Command{
 		Trigger:          CommandTrigger,
 		AutoComplete:     true,
-		AutoCompleteHint: "[help|prefs|stats]",
+		AutoCompleteHint: "[help|prefs|schedule|pause|resume|quiethours|keywords|delivery|channel|team|stats|outbox|audit|policy]",
 		AutoCompleteDesc: "Configure the Missed Activity Plugin",
+		AutocompleteData: getAutocompleteData(),
 	}); err != nil {
 		return errors.Wrap(err, "failed to register the command")
 	}
@@ -34,7 +139,7 @@ func (p *MANPlugin) registerMANCommand() error {
 
 func commandStats(user *model.User, _ []string, backend *backend.MattermostBackend, manRunStats *MANRunStats, userstatus *userstatus.UserStatusTracker) (string, error) {
 	if !user.IsAdmin() {
-		return "Only administrators can see stats", nil
+		return i18n.T(user.Locale, "command.admin_only.stats"), nil
 	}
 
 	out := output.PrintUserStatuses(userstatus, backend, manRunStats.sentEmailStats)
@@ -56,7 +161,7 @@ func commandStats(user *model.User, _ []string, backend *backend.MattermostBacke
 
 func commandResetAll(user *model.User, backend *backend.MattermostBackend) (string, error) {
 	if !user.IsAdmin() {
-		return "Only administrators can reset all user preferences", nil
+		return i18n.T(user.Locale, "command.admin_only.reset"), nil
 	}
 
 	err := backend.ResetAllUserPrefernces()
@@ -64,14 +169,14 @@ func commandResetAll(user *model.User, backend *backend.MattermostBackend) (stri
 		return "", err
 	}
 
-	return "All user preferences reset", nil
+	return i18n.T(user.Locale, "command.reset.done"), nil
 }
 
 func commandPrefs(user *model.User, args []string, backend *backend.MattermostBackend) (string, error) {
 	if len(args) == 1 {
 		switch args[0] {
 		case "show":
-			out := "### Current preferences:\n"
+			out := fmt.Sprintf("### %s\n", i18n.T(user.Locale, "command.prefs.title"))
 			res, _ := reflections.Items(user.MANPreferences)
 			for k, v := range res {
 				out += fmt.Sprintf("  - **%s**: %v\n", k, v)
@@ -83,7 +188,7 @@ func commandPrefs(user *model.User, args []string, backend *backend.MattermostBa
 			if err != nil {
 				return "", err
 			}
-			return "preferences reset", nil
+			return i18n.T(user.Locale, "command.prefs.reset"), nil
 		}
 	}
 
@@ -92,7 +197,12 @@ func commandPrefs(user *model.User, args []string, backend *backend.MattermostBa
 		has, _ := reflections.HasField(user.MANPreferences, field)
 
 		if !has {
-			return fmt.Sprintf("invalid preference name '%s'", field), nil
+			return i18n.T(user.Locale, "command.prefs.invalid_name", field), nil
+		}
+
+		// keywords are edited only with their command, that adds and removes them
+		if field == "Keywords" {
+			return i18n.T(user.Locale, "command.prefs.use_command", field, "keywords"), nil
 		}
 
 		currValue, _ := reflections.GetField(user.MANPreferences, field)
@@ -110,6 +220,15 @@ func commandPrefs(user *model.User, args []string, backend *backend.MattermostBa
 				return "", errB
 			}
 			newVal = boolValue
+		case int64:
+			intValue, errI := strconv.ParseInt(args[1], 10, 64)
+			if errI != nil {
+				return "", errI
+			}
+			newVal = intValue
+		default:
+			// lists and maps are managed by their own commands
+			return i18n.T(user.Locale, "command.prefs.unsupported", field), nil
 		}
 
 		errS := backend.SetUserPreference(user, field, newVal)
@@ -117,46 +236,668 @@ func commandPrefs(user *model.User, args []string, backend *backend.MattermostBa
 			return "", errS
 		}
 
-		return fmt.Sprintf("preference %s = %t", field, newVal), nil
+		return i18n.T(user.Locale, "command.prefs.set", field, newVal), nil
+	}
+	return i18n.T(user.Locale, "command.prefs.invalid_args"), nil
+}
+
+func commandSchedule(user *model.User, args []string, backend *backend.MattermostBackend) (string, error) {
+	if len(args) == 0 {
+		schedule := user.MANPreferences.Schedule
+		if schedule == "" {
+			schedule = i18n.T(user.Locale, "command.schedule.every_run")
+		}
+		return i18n.T(user.Locale, "command.schedule.current", schedule, user.Location()), nil
+	}
+
+	spec := strings.Join(args, " ")
+	if spec == "clear" {
+		spec = ""
+	}
+
+	if _, errP := model.ParseSchedule(spec); errP != nil {
+		return i18n.T(user.Locale, "command.schedule.invalid", errP), nil
+	}
+
+	errS := backend.SetUserPreference(user, "Schedule", spec)
+	if errS != nil {
+		return "", errS
+	}
+
+	// delivery times are counted from now, to avoid sending a notification
+	// for a delivery time in the past
+	errT := backend.SetUsersLastProcessedTimestamp([]string{user.ID}, time.Now())
+	if errT != nil {
+		return "", errT
+	}
+
+	if spec == "" {
+		return i18n.T(user.Locale, "command.schedule.cleared"), nil
+	}
+	return i18n.T(user.Locale, "command.schedule.set", spec, user.Location()), nil
+}
+
+// parses durations like "90m", "3h", "2d" or "1w"
+func parsePauseDuration(value string) (time.Duration, error) {
+	if len(value) > 1 {
+		switch value[len(value)-1] {
+		case 'd', 'w':
+			n, err := strconv.Atoi(value[:len(value)-1])
+			if err != nil {
+				return 0, err
+			}
+			days := n
+			if value[len(value)-1] == 'w' {
+				days = n * 7
+			}
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	}
+	return time.ParseDuration(value)
+}
+
+func commandPause(user *model.User, args []string, backend *backend.MattermostBackend) (string, error) {
+	if len(args) == 0 {
+		if user.MANPreferences.IsPausedAt(time.Now()) {
+			return i18n.T(user.Locale, "command.pause.paused", time.UnixMilli(user.MANPreferences.PausedUntil).In(user.Location()).Format("Mon Jan 2 15:04 MST")), nil
+		}
+		return i18n.T(user.Locale, "command.pause.not_paused"), nil
+	}
+
+	var until time.Time
+
+	if args[0] == "until" {
+		value := strings.Join(args[1:], " ")
+		t, err := time.ParseInLocation("2006-01-02 15:04", value, user.Location())
+		if err != nil {
+			t, err = time.ParseInLocation("2006-01-02", value, user.Location())
+		}
+		if err != nil {
+			return i18n.T(user.Locale, "command.pause.invalid_date", value), nil
+		}
+		until = t
+	} else {
+		d, err := parsePauseDuration(args[0])
+		if err != nil || d <= 0 {
+			return i18n.T(user.Locale, "command.pause.invalid_duration", args[0]), nil
+		}
+		until = time.Now().Add(d)
+	}
+
+	if !until.After(time.Now()) {
+		return i18n.T(user.Locale, "command.pause.past"), nil
+	}
+
+	errS := backend.SetUserPreference(user, "PausedUntil", until.UnixMilli())
+	if errS != nil {
+		return "", errS
+	}
+
+	return i18n.T(user.Locale, "command.pause.set", until.In(user.Location()).Format("Mon Jan 2 15:04 MST")), nil
+}
+
+func commandDelivery(user *model.User, args []string, backend *backend.MattermostBackend) (string, error) {
+	if len(args) == 0 {
+		method := user.MANPreferences.DeliveryMethod
+		if method == "" {
+			method = delivery.EmailMethod
+		}
+		return i18n.T(user.Locale, "command.delivery.current", method), nil
+	}
+
+	if len(args) != 1 || (args[0] != delivery.EmailMethod && args[0] != delivery.BotMethod) {
+		return i18n.T(user.Locale, "command.delivery.usage", delivery.EmailMethod, delivery.BotMethod), nil
+	}
+
+	errS := backend.SetUserPreference(user, "DeliveryMethod", args[0])
+	if errS != nil {
+		return "", errS
+	}
+	return i18n.T(user.Locale, "command.delivery.set", args[0]), nil
+}
+
+func commandResume(user *model.User, backend *backend.MattermostBackend) (string, error) {
+	errS := backend.SetUserPreference(user, "PausedUntil", int64(0))
+	if errS != nil {
+		return "", errS
+	}
+	return i18n.T(user.Locale, "command.resume.done"), nil
+}
+
+func commandQuietHours(user *model.User, args []string, backend *backend.MattermostBackend) (string, error) {
+	if len(args) == 0 {
+		if user.MANPreferences.QuietHours == "" {
+			return i18n.T(user.Locale, "command.quiethours.not_set"), nil
+		}
+		return i18n.T(user.Locale, "command.quiethours.current", user.MANPreferences.QuietHours, user.Location()), nil
+	}
+
+	spec := strings.Join(args, "")
+	if spec == "clear" {
+		spec = ""
+	}
+
+	if _, errP := model.ParseQuietHours(spec); errP != nil {
+		return errP.Error(), nil
+	}
+
+	errS := backend.SetUserPreference(user, "QuietHours", spec)
+	if errS != nil {
+		return "", errS
+	}
+
+	if spec == "" {
+		return i18n.T(user.Locale, "command.quiethours.cleared"), nil
+	}
+	return i18n.T(user.Locale, "command.quiethours.set", spec, user.Location()), nil
+}
+
+func commandKeywords(user *model.User, args []string, backend *backend.MattermostBackend) (string, error) {
+	keywords := user.MANPreferences.Keywords
+
+	if len(args) == 0 || args[0] == "list" {
+		if len(keywords) == 0 {
+			return i18n.T(user.Locale, "command.keywords.none_help"), nil
+		}
+		return i18n.T(user.Locale, "command.keywords.current", strings.Join(keywords, "**, **")), nil
+	}
+
+	// keywords are separated by commas and can contain spaces
+	values := []string{}
+	for _, v := range strings.Split(strings.Join(args[1:], " "), ",") {
+		if strings.TrimSpace(v) != "" {
+			values = append(values, strings.TrimSpace(v))
+		}
+	}
+
+	newKeywords := []string{}
+
+	switch args[0] {
+	case "add":
+		newKeywords = append(newKeywords, keywords...)
+		for _, v := range values {
+			if !slices.Contains(newKeywords, v) {
+				newKeywords = append(newKeywords, v)
+			}
+		}
+	case "remove":
+		for _, k := range keywords {
+			if !slices.Contains(values, k) {
+				newKeywords = append(newKeywords, k)
+			}
+		}
+	case "clear":
+	default:
+		return i18n.T(user.Locale, "command.keywords.invalid"), nil
+	}
+
+	errS := backend.SetUserPreference(user, "Keywords", newKeywords)
+	if errS != nil {
+		return "", errS
+	}
+
+	if len(newKeywords) == 0 {
+		return i18n.T(user.Locale, "command.keywords.none"), nil
+	}
+	return i18n.T(user.Locale, "command.keywords.current", strings.Join(newKeywords, "**, **")), nil
+}
+
+func commandOutbox(user *model.User, args []string, backend *backend.MattermostBackend) (string, error) {
+	if !user.IsAdmin() {
+		return i18n.T(user.Locale, "command.admin_only.outbox"), nil
+	}
+
+	entries, err := backend.GetOutboxEntries()
+	if err != nil {
+		return "", err
+	}
+
+	if len(args) == 0 || args[0] == "list" {
+		out := fmt.Sprintf("### %s\n", i18n.T(user.Locale, "command.outbox.title"))
+		if len(entries) == 0 {
+			out += i18n.T(user.Locale, "command.outbox.empty") + "\n"
+		}
+		for _, e := range entries {
+			status := i18n.T(user.Locale, "command.outbox.next_attempt", time.UnixMilli(e.NextAttemptAt).Format(time.RFC822))
+			if e.Failed {
+				status = i18n.T(user.Locale, "command.outbox.failed")
+			}
+			out += fmt.Sprintf("  - %s\n", i18n.T(user.Locale, "command.outbox.entry", e.ID, e.Username, e.TeamName, e.Subject, e.Attempts, status, e.LastError))
+		}
+
+		flagged, errF := backend.GetFlaggedUsers()
+		if errF != nil {
+			return "", errF
+		}
+		if len(flagged) > 0 {
+			out += fmt.Sprintf("### %s\n", i18n.T(user.Locale, "command.outbox.flagged_title"))
+			for userID, t := range flagged {
+				username := userID
+				if u, errU := backend.GetUser(userID); errU == nil {
+					username = u.Username
+				}
+				out += fmt.Sprintf("  - %s\n", i18n.T(user.Locale, "command.outbox.flagged", username, t.Format(time.RFC822)))
+			}
+		}
+		return out, nil
+	}
+
+	if len(args) != 2 || (args[0] != "retry" && args[0] != "delete") {
+		return i18n.T(user.Locale, "command.outbox.usage"), nil
+	}
+
+	count := 0
+	for _, e := range entries {
+		if args[1] != "all" && args[1] != e.ID {
+			continue
+		}
+
+		if args[0] == "retry" {
+			e.Attempts = 0
+			e.Failed = false
+			e.NextAttemptAt = 0
+			if errS := backend.SaveOutboxEntry(e); errS != nil {
+				return "", errS
+			}
+		} else if errD := backend.DeleteOutboxEntry(e.ID); errD != nil {
+			return "", errD
+		}
+
+		if errF := backend.SetUserFlagged(e.UserID, false, time.Now()); errF != nil {
+			return "", errF
+		}
+		count++
+	}
+
+	if args[0] == "retry" {
+		return i18n.T(user.Locale, "command.outbox.retried", count), nil
+	}
+	return i18n.T(user.Locale, "command.outbox.deleted", count), nil
+}
+
+// returns the channel named in the arguments (e.g., ~town-square) in the
+// team, or the current channel if not specified
+func getCommandChannel(args []string, cmdArgs *mm_model.CommandArgs, backend *backend.MattermostBackend) (*model.Channel, error) {
+	if len(args) == 0 {
+		return backend.GetChannel(cmdArgs.ChannelId)
+	}
+	return backend.GetChannelByName(cmdArgs.TeamId, strings.TrimPrefix(args[0], "~"))
+}
+
+func commandChannel(user *model.User, args []string, cmdArgs *mm_model.CommandArgs, backend *backend.MattermostBackend) (string, error) {
+	if len(args) == 0 || args[0] == "list" {
+		if len(user.MANPreferences.ExcludedChannels) == 0 && len(user.MANPreferences.IncludedChannels) == 0 {
+			return i18n.T(user.Locale, "command.channel.none"), nil
+		}
+
+		names := func(ids []string) string {
+			res := []string{}
+			for _, id := range ids {
+				if ch, err := backend.GetChannel(id); err == nil {
+					res = append(res, ch.GetChannelName(user))
+				} else {
+					res = append(res, id)
+				}
+			}
+			return strings.Join(res, "**, **")
+		}
+
+		out := ""
+		if len(user.MANPreferences.ExcludedChannels) > 0 {
+			out += i18n.T(user.Locale, "command.channel.list_excluded", names(user.MANPreferences.ExcludedChannels)) + "\n"
+		}
+		if len(user.MANPreferences.IncludedChannels) > 0 {
+			out += i18n.T(user.Locale, "command.channel.list_included", names(user.MANPreferences.IncludedChannels)) + "\n"
+		}
+		return out, nil
+	}
+
+	setting := args[0]
+	if len(args) > 2 || (setting != model.ChannelExclude && setting != model.ChannelInclude && setting != model.ChannelReset) {
+		return i18n.T(user.Locale, "command.channel.usage"), nil
+	}
+
+	channel, errC := getCommandChannel(args[1:], cmdArgs, backend)
+	if errC != nil {
+		return i18n.T(user.Locale, "command.channel.not_found", strings.Join(args[1:], " ")), nil
+	}
+
+	errS := backend.UpdatePreferencesForUser(user.ID, func(prefs *model.MANUserPreferences) error {
+		prefs.SetChannelSetting(channel.ID, setting)
+		return nil
+	})
+	if errS != nil {
+		return "", errS
+	}
+
+	return i18n.T(user.Locale, "command.channel."+setting, channel.GetChannelName(user)), nil
+}
+
+// returns the team named in the arguments (its display name or "direct" for
+// the direct messages), or the current team if not specified
+func getCommandTeam(args []string, user *model.User, cmdArgs *mm_model.CommandArgs, backend *backend.MattermostBackend) (*model.Team, error) {
+	if len(args) == 1 && args[0] == "direct" {
+		return model.DirectMessagesFakeTeam, nil
+	}
+
+	teams, err := backend.GetTeamsForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.Join(args, " ")
+	for _, t := range teams {
+		if (name == "" && t.ID == cmdArgs.TeamId) || (name != "" && strings.EqualFold(t.Name, name)) {
+			return t, nil
+		}
+	}
+	return nil, errors.Errorf("team '%s' not found", name)
+}
+
+func commandTeam(user *model.User, args []string, cmdArgs *mm_model.CommandArgs, backend *backend.MattermostBackend) (string, error) {
+	prefs := user.MANPreferences
+
+	if len(args) == 0 || args[0] == "list" {
+		out := i18n.T(user.Locale, "command.team.merge."+strconv.FormatBool(prefs.MergeTeams)) + "\n"
+		if len(prefs.Teams) == 0 {
+			return out + i18n.T(user.Locale, "command.team.none"), nil
+		}
+
+		teams, err := backend.GetTeamsForUser(user.ID)
+		if err != nil {
+			return "", err
+		}
+		teams = append(teams, model.DirectMessagesFakeTeam)
+
+		for _, t := range teams {
+			tp, ok := prefs.Teams[t.ID]
+			if !ok {
+				continue
+			}
+			settings := []string{}
+			if tp.Disabled {
+				settings = append(settings, i18n.T(user.Locale, "command.team.disabled"))
+			}
+			for _, name := range model.TeamPreferenceNames {
+				if v, has := tp.Overrides[name]; has {
+					settings = append(settings, fmt.Sprintf("%s = %v", name, v))
+				}
+			}
+			out += fmt.Sprintf("  - **%s**: %s\n", t.Name, strings.Join(settings, ", "))
+		}
+		return out, nil
+	}
+
+	var teamArgs []string
+	switch {
+	case args[0] == "merge" && len(args) == 2:
+		merge, errB := strconv.ParseBool(args[1])
+		if errB != nil {
+			return i18n.T(user.Locale, "command.team.usage"), nil
+		}
+		if errS := backend.SetUserPreference(user, "MergeTeams", merge); errS != nil {
+			return "", errS
+		}
+		return i18n.T(user.Locale, "command.team.merge."+strconv.FormatBool(merge)), nil
+	case args[0] == "enable" || args[0] == "disable" || args[0] == "reset":
+		teamArgs = args[1:]
+	case args[0] == "set" && len(args) >= 3:
+		teamArgs = args[3:]
+	default:
+		return i18n.T(user.Locale, "command.team.usage"), nil
+	}
+
+	team, errT := getCommandTeam(teamArgs, user, cmdArgs, backend)
+	if errT != nil {
+		return i18n.T(user.Locale, "command.team.not_found", strings.Join(teamArgs, " ")), nil
+	}
+
+	var message string
+	var update func(prefs *model.MANUserPreferences)
+	switch args[0] {
+	case "enable", "disable":
+		update = func(prefs *model.MANUserPreferences) { prefs.SetTeamEnabled(team.ID, args[0] == "enable") }
+		message = i18n.T(user.Locale, "command.team."+args[0], team.Name)
+	case "reset":
+		update = func(prefs *model.MANUserPreferences) { prefs.ResetTeam(team.ID) }
+		message = i18n.T(user.Locale, "command.team.reset", team.Name)
+	case "set":
+		if !model.IsTeamPreferenceName(args[1]) {
+			return i18n.T(user.Locale, "command.team.invalid_name", args[1], strings.Join(model.TeamPreferenceNames, ", ")), nil
+		}
+		value, errB := strconv.ParseBool(args[2])
+		if errB != nil {
+			return i18n.T(user.Locale, "command.team.usage"), nil
+		}
+		update = func(prefs *model.MANUserPreferences) { prefs.SetTeamOverride(team.ID, args[1], value) }
+		message = i18n.T(user.Locale, "command.team.set", args[1], value, team.Name)
+	}
+
+	errS := backend.UpdatePreferencesForUser(user.ID, func(prefs *model.MANUserPreferences) error {
+		update(prefs)
+		return nil
+	})
+	if errS != nil {
+		return "", errS
+	}
+	return message, nil
+}
+
+// returns the description of the policy, e.g. "**never** `bot-*` in **Team**"
+func describePolicy(user *model.User, policy *model.ChannelPolicy, teams []*model.Team) string {
+	if policy.TeamID == "" {
+		return i18n.T(user.Locale, "command.policy.entry_all_teams", policy.Mode, policy.Channel)
+	}
+	teamName := policy.TeamID
+	for _, t := range teams {
+		if t.ID == policy.TeamID {
+			teamName = t.Name
+		}
+	}
+	return i18n.T(user.Locale, "command.policy.entry", policy.Mode, policy.Channel, teamName)
+}
+
+// shows how the channels of the user are handled, with the admin policies
+// applied before the preferences of the user
+func showEffectivePolicy(user *model.User, target *model.User, policies model.ChannelPolicies, backend *backend.MattermostBackend) (string, error) {
+	out := fmt.Sprintf("### %s\n", i18n.T(user.Locale, "command.policy.show_title", target.Username))
+	if !target.MANPreferences.Enabled {
+		out += i18n.T(user.Locale, "command.policy.user_disabled") + "\n"
+	}
+
+	teams, err := backend.GetTeamsForUser(target.ID)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{}
+	for _, team := range teams {
+		memberships, errM := backend.GetChannelMembersForUser(team.ID, target.ID, false)
+		if errM != nil {
+			return "", errM
+		}
+		for _, m := range memberships {
+			status, policy := model.GetChannelStatus(policies, m)
+			if status == model.ChannelNotified {
+				continue
+			}
+			reason := i18n.T(user.Locale, "command.policy.status."+status)
+			if policy != nil {
+				reason += " (#" + strconv.Itoa(slices.Index(policies, policy)+1) + ")"
+			}
+			lines = append(lines, fmt.Sprintf("  - ~%s (%s): %s", m.Channel.Name, team.Name, reason))
+		}
+	}
+	sort.Strings(lines)
+
+	if len(lines) == 0 {
+		return out + i18n.T(user.Locale, "command.policy.all_notified"), nil
+	}
+	return out + strings.Join(lines, "\n"), nil
+}
+
+func commandPolicy(user *model.User, args []string, backend *backend.MattermostBackend) (string, error) {
+	if !user.IsAdmin() {
+		return i18n.T(user.Locale, "command.admin_only.policy"), nil
+	}
+
+	policies, err := backend.GetChannelPolicies()
+	if err != nil {
+		return "", err
+	}
+	teams, err := backend.GetTeams()
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case len(args) == 0 || args[0] == "list":
+		out := fmt.Sprintf("### %s\n", i18n.T(user.Locale, "command.policy.title"))
+		if len(policies) == 0 {
+			return out + i18n.T(user.Locale, "command.policy.empty"), nil
+		}
+		for i, p := range policies {
+			out += fmt.Sprintf("%d. %s\n", i+1, describePolicy(user, p, teams))
+		}
+		return out, nil
+
+	case args[0] == "add" && len(args) >= 3:
+		policy := &model.ChannelPolicy{Mode: args[1], Channel: strings.TrimPrefix(args[2], "~")}
+		if errV := policy.Validate(); errV != nil {
+			return i18n.T(user.Locale, "command.policy.invalid", errV), nil
+		}
+		if len(args) > 3 {
+			teamName := strings.Join(args[3:], " ")
+			for _, t := range teams {
+				if strings.EqualFold(t.Name, teamName) {
+					policy.TeamID = t.ID
+				}
+			}
+			if policy.TeamID == "" {
+				return i18n.T(user.Locale, "command.team.not_found", teamName), nil
+			}
+		}
+		if errS := backend.SaveChannelPolicies(append(policies, policy)); errS != nil {
+			return "", errS
+		}
+		return i18n.T(user.Locale, "command.policy.added", describePolicy(user, policy, teams)), nil
+
+	case args[0] == "remove" && len(args) == 2:
+		n, errN := strconv.Atoi(args[1])
+		if errN != nil || n < 1 || n > len(policies) {
+			return i18n.T(user.Locale, "command.policy.not_found", args[1]), nil
+		}
+		removed := policies[n-1]
+		if errS := backend.SaveChannelPolicies(slices.Delete(policies, n-1, n)); errS != nil {
+			return "", errS
+		}
+		return i18n.T(user.Locale, "command.policy.removed", describePolicy(user, removed, teams)), nil
+
+	case args[0] == "show" && len(args) == 2:
+		target, errU := backend.GetUserByUsername(strings.TrimPrefix(args[1], "@"))
+		if errU != nil {
+			return i18n.T(user.Locale, "command.policy.user_not_found", args[1]), nil
+		}
+		return showEffectivePolicy(user, target, policies, backend)
 	}
-	return "invalid number of arguments", nil
+
+	return i18n.T(user.Locale, "command.policy.usage"), nil
+}
+
+// number of audit log entries shown by the audit command
+const auditEntriesToShow = 50
+
+func commandAudit(user *model.User, backend *backend.MattermostBackend) (string, error) {
+	if !user.IsAdmin() {
+		return i18n.T(user.Locale, "command.admin_only.audit"), nil
+	}
+
+	entries, err := backend.GetActionAuditLog()
+	if err != nil {
+		return "", err
+	}
+
+	out := fmt.Sprintf("### %s\n", i18n.T(user.Locale, "command.audit.title"))
+	if len(entries) == 0 {
+		out += i18n.T(user.Locale, "command.audit.empty") + "\n"
+	}
+
+	// newest first
+	for i := len(entries) - 1; i >= 0 && i >= len(entries)-auditEntriesToShow; i-- {
+		e := entries[i]
+		details := e.ChannelID
+		if e.Error != "" {
+			details += " " + i18n.T(user.Locale, "command.audit.failed", e.Error)
+		}
+		out += fmt.Sprintf("  - %s\n", i18n.T(user.Locale, "command.audit.entry", time.UnixMilli(e.Time).Format(time.RFC822), e.Username, e.Action, details))
+	}
+
+	return out, nil
 }
 
-func (p *MANPlugin) executeCommandImpl(userID string, command string, args []string) (string, error) {
-	user, uErr := p.backend.GetUser(userID)
+func (p *MANPlugin) executeCommandImpl(cmdArgs *mm_model.CommandArgs, command string, args []string) (string, error) {
+	user, uErr := p.backend.GetUser(cmdArgs.UserId)
 
 	if uErr != nil {
 		return "", errors.Wrap(uErr, "error getting user")
 	}
 
 	switch command {
+	case "":
+		return i18n.T(user.Locale, "command.not_specified"), nil
 	case "prefs":
 		return commandPrefs(user, args, p.backend)
+	case "schedule":
+		return commandSchedule(user, args, p.backend)
+	case "pause":
+		return commandPause(user, args, p.backend)
+	case "resume":
+		return commandResume(user, p.backend)
+	case "quiethours":
+		return commandQuietHours(user, args, p.backend)
+	case "keywords":
+		return commandKeywords(user, args, p.backend)
+	case "delivery":
+		return commandDelivery(user, args, p.backend)
+	case "channel":
+		return commandChannel(user, args, cmdArgs, p.backend)
+	case "team":
+		return commandTeam(user, args, cmdArgs, p.backend)
 	case "help":
 		readme := p.backend.GetReadmeContent()
 		if strings.Index(readme, "## Admin Configuration") > 0 {
 			//nolint:gocritic
 			readme = readme[:strings.Index(readme, "## Admin Configuration")]
 		}
-		helpMsg := fmt.Sprintf("%s\n\n---\n### Look at https://github.com/ggiammat/mattermost-missed-activity-notifier for additional documentation", readme)
+		helpMsg := fmt.Sprintf("%s\n\n---\n### %s", readme, i18n.T(user.Locale, "command.help.more", "https://github.com/ggiammat/mattermost-missed-activity-notifier"))
 		return helpMsg, nil
 	case "stats":
 		return commandStats(user, args, p.backend, p.manRunStats, p.userStatuses)
+	case "outbox":
+		return commandOutbox(user, args, p.backend)
+	case "audit":
+		return commandAudit(user, p.backend)
+	case "policy":
+		return commandPolicy(user, args, p.backend)
 	case "reset-all-user-prefs":
 		return commandResetAll(user, p.backend)
 	}
-	return "Invalid command", nil
+	return i18n.T(user.Locale, "command.invalid"), nil
 }
 
 // Mattermost Hook
 func (p *MANPlugin) ExecuteCommand(_ *plugin.Context, args *mm_model.CommandArgs) (*mm_model.CommandResponse, *mm_model.AppError) {
 	tokens := strings.Split(strings.Trim(args.Command, " "), " ")
 
-	if len(tokens) < 2 {
-		return &mm_model.CommandResponse{Text: "Command not specified"}, nil
+	command := ""
+	if len(tokens) > 1 {
+		command = tokens[1]
+		tokens = tokens[2:]
+	} else {
+		tokens = []string{}
 	}
 
-	res, err := p.executeCommandImpl(args.UserId, tokens[1], tokens[2:])
+	res, err := p.executeCommandImpl(args, command, tokens)
 
 	if err != nil {
 		return &mm_model.CommandResponse{Text: res}, mm_model.NewAppError("MANAppError", "command error", nil, "error executing command", 1).Wrap(err)
@@ -2,8 +2,11 @@ package main
 
 import (
 	"reflect"
+	"strings"
 
 	"github.com/pkg/errors"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/man"
 )
 
 type configuration struct {
@@ -14,6 +17,12 @@ type configuration struct {
 	NotifyOnlyNewMessagesFromStartup       bool
 	KeepStatusHistoryInterval              int
 	RunStatsToKeep                         int
+	MaxConcurrency                         int
+	OutboxMaxAttempts                      int
+	WebhookURL                             string
+	WebhookSecret                          string
+	EmailSender                            string
+	TimestampFormat                        string
 	EmailSubTitle                          string
 	EmailButtonText                        string
 	EmailFooterLine1                       string
@@ -27,7 +36,50 @@ type configuration struct {
 	UserDefaultPrefCountPreviouslyNotified bool
 	UserDefaultIncludeSystemMessages       bool
 	UserDefaultPrefIncludeMessagesFromBots bool
+	UserDefaultPrefSchedule                string
+	UserDefaultPrefDeliveryMethod          string
+	UserDefaultPrefMergeTeams              bool
 	DebugHTTPToken                         string
+	DisabledFilters                        string
+	AlreadyNotifiedBy                      string
+}
+
+// returns the types of Mattermost notifications after which a message is
+// considered already notified, and the unknown ones. Installs upgraded from
+// versions without the setting have an empty value: without valid types,
+// email is used as in those versions
+func (c *configuration) parseAlreadyNotifiedBy() ([]string, []string) {
+	valid, invalid := []string{}, []string{}
+	for _, name := range strings.Split(c.AlreadyNotifiedBy, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "":
+		case man.MMEmailNotification, man.MMPushNotification, man.MMDesktopNotification:
+			valid = append(valid, name)
+		default:
+			invalid = append(invalid, name)
+		}
+	}
+	if len(valid) == 0 {
+		valid = append(valid, man.MMEmailNotification)
+	}
+	return valid, invalid
+}
+
+func (c *configuration) GetAlreadyNotifiedBy() []string {
+	valid, _ := c.parseAlreadyNotifiedBy()
+	return valid
+}
+
+// returns the names of the filters disabled by the administrator
+func (c *configuration) GetDisabledFilters() []string {
+	res := []string{}
+	for _, name := range strings.Split(c.DisabledFilters, ",") {
+		if strings.TrimSpace(name) != "" {
+			res = append(res, strings.TrimSpace(name))
+		}
+	}
+	return res
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -97,6 +149,16 @@ func (p *MANPlugin) OnConfigurationChange() error {
 		p.backend.LogError("error creating backend: %s", errB)
 	}
 
+	if _, invalid := configuration.parseAlreadyNotifiedBy(); len(invalid) > 0 {
+		p.backend.LogWarn("Unknown notification types in AlreadyNotifiedBy are ignored: %s", strings.Join(invalid, ", "))
+	}
+
+	switch configuration.EmailSender {
+	case "", emailSenderMattermost, emailSenderSMTP:
+	default:
+		p.backend.LogWarn("Unknown EmailSender '%s', emails are sent with the plugin API", configuration.EmailSender)
+	}
+
 	if restartMANJob {
 		p.backend.LogInfo("MAN run interval changed in configuration. Restarting scheduler")
 		errD := p.deactivateMANJob()
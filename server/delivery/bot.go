@@ -0,0 +1,34 @@
+package delivery
+
+import (
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/backend"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/output"
+)
+
+// posts the digest as a Markdown direct message from the plugin bot
+type BotNotifier struct {
+	backend    *backend.MattermostBackend
+	timeFormat string
+}
+
+func NewBotNotifier(backend *backend.MattermostBackend, timeFormat string) *BotNotifier {
+	return &BotNotifier{backend: backend, timeFormat: timeFormat}
+}
+
+func (n *BotNotifier) Name() string { return BotMethod }
+
+func (n *BotNotifier) Render(missedActivity *model.TeamMissedActivity) (*Message, error) {
+	title, body, err := output.BuildMarkdownDigest(n.backend, missedActivity, n.timeFormat)
+	if err != nil {
+		return nil, err
+	}
+	if body == "" {
+		return nil, nil
+	}
+	return &Message{Subject: title, Body: body}, nil
+}
+
+func (n *BotNotifier) Send(user *model.User, msg *Message) error {
+	return n.backend.SendDirectMessage(user, msg.Body)
+}
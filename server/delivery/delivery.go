@@ -0,0 +1,56 @@
+package delivery
+
+import (
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+// names of the delivery methods, used in the user preferences
+const (
+	EmailMethod = "email"
+	BotMethod   = "bot"
+)
+
+// a rendered digest, ready to be sent
+type Message struct {
+	Subject string
+	Body    string
+	// plain text version of the body, for methods that support it
+	Text string
+	// messages with the same thread are grouped by mail clients
+	Thread string
+}
+
+// A Notifier renders and delivers the missed activity of a user
+type Notifier interface {
+	// the name of the delivery method
+	Name() string
+	// returns nil if there is nothing to notify
+	Render(missedActivity *model.TeamMissedActivity) (*Message, error)
+	Send(user *model.User, msg *Message) error
+}
+
+// the available notifiers, by delivery method
+type Notifiers map[string]Notifier
+
+// returns the notifier for the delivery method. Unknown (or empty) methods
+// fall back to email
+func (n Notifiers) Get(method string) Notifier {
+	if notifier, ok := n[method]; ok {
+		return notifier
+	}
+	return n[EmailMethod]
+}
+
+// returns the notifier for the delivery method, without falling back to email
+func (n Notifiers) Lookup(method string) (Notifier, bool) {
+	notifier, ok := n[method]
+	return notifier, ok
+}
+
+func NewNotifiers(notifiers ...Notifier) Notifiers {
+	res := Notifiers{}
+	for _, n := range notifiers {
+		res[n.Name()] = n
+	}
+	return res
+}
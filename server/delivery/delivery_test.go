@@ -0,0 +1,16 @@
+package delivery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifiersGet(t *testing.T) {
+	notifiers := NewNotifiers(NewEmailNotifier(nil, nil, false), NewBotNotifier(nil, ""))
+
+	assert.Equal(t, BotMethod, notifiers.Get("bot").Name())
+	assert.Equal(t, EmailMethod, notifiers.Get("email").Name())
+	assert.Equal(t, EmailMethod, notifiers.Get("").Name())
+	assert.Equal(t, EmailMethod, notifiers.Get("pigeon").Name())
+}
@@ -0,0 +1,116 @@
+package delivery
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/backend"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/mail"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/output"
+)
+
+// sends the digest as an email. If multipart is true, the email has both an
+// html and a plain text version, the photos of the senders as attachments and
+// it is sent with the smtp server configured in Mattermost. Otherwise it is
+// html only and it is sent with the plugin API
+type EmailNotifier struct {
+	backend   *backend.MattermostBackend
+	props     *output.EmailTemplateProps
+	multipart bool
+}
+
+func NewEmailNotifier(backend *backend.MattermostBackend, props *output.EmailTemplateProps, multipart bool) *EmailNotifier {
+	return &EmailNotifier{backend: backend, props: props, multipart: multipart}
+}
+
+func (n *EmailNotifier) Name() string { return EmailMethod }
+
+func (n *EmailNotifier) Render(missedActivity *model.TeamMissedActivity) (*Message, error) {
+	props := n.props
+	if n.multipart {
+		withAttachments := *n.props
+		withAttachments.AttachedAvatars = true
+		props = &withAttachments
+	}
+
+	subject, body, err := output.BuildHTMLEmail(n.backend, missedActivity, props)
+	if err != nil {
+		return nil, err
+	}
+	if body == "" {
+		return nil, nil
+	}
+
+	msg := &Message{Subject: subject, Body: body, Thread: missedActivity.Team.ID}
+	if n.multipart {
+		text, errT := output.BuildPlainTextEmail(n.backend, missedActivity, n.props)
+		if errT != nil {
+			return nil, errT
+		}
+		msg.Text = text
+	}
+	return msg, nil
+}
+
+func (n *EmailNotifier) Send(user *model.User, msg *Message) error {
+	if n.multipart && msg.Text != "" {
+		return n.backend.SendMIMEEmailToUser(user, n.buildMIMEMessage(user, msg))
+	}
+	return n.backend.SendEmailToUser(user, msg.Subject, msg.Body)
+}
+
+// returns the id of the first (fake) message of the thread. Digests of the
+// same user and team refer to it, so that mail clients group them
+func (n *EmailNotifier) threadRootID(user *model.User, thread string) string {
+	if thread == "" {
+		thread = "direct"
+	}
+	return fmt.Sprintf("<digest.%s.%s@%s>", user.ID, thread, n.backend.GetServerHostname())
+}
+
+func (n *EmailNotifier) buildMIMEMessage(user *model.User, msg *Message) *mail.Message {
+	host := n.backend.GetServerHostname()
+	threadRoot := n.threadRootID(user, msg.Thread)
+
+	res := &mail.Message{
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.Body,
+		Images:  []*mail.InlineImage{},
+		Headers: map[string]string{
+			"Message-ID":       mail.NewMessageID(host),
+			"In-Reply-To":      threadRoot,
+			"References":       threadRoot,
+			"List-Id":          fmt.Sprintf("Missed Activity <missed-activity.%s>", host),
+			"List-Unsubscribe": fmt.Sprintf("<%s/unsubscribe>", n.backend.GetPluginURL()),
+		},
+	}
+
+	// with a signed link, mail clients can unsubscribe with one click (RFC 8058)
+	if unsubscribeURL, errU := n.backend.BuildActionURL(user.ID, model.ActionDisable, ""); errU == nil {
+		res.Headers["List-Unsubscribe"] = fmt.Sprintf("<%s>", unsubscribeURL)
+		res.Headers["List-Unsubscribe-Post"] = "List-Unsubscribe=One-Click"
+	} else {
+		n.backend.LogWarn("Cannot build the unsubscribe link for user %s: %s", user.Username, errU)
+	}
+
+	// photos are loaded when sending, so they are not stored with the
+	// digests in the outbox
+	for _, userID := range output.GetAttachedAvatars(msg.Body) {
+		author, errU := n.backend.GetUser(userID)
+		if errU != nil || len(author.Image) == 0 {
+			n.backend.LogWarn("Cannot attach the photo of user %s: %v", userID, errU)
+			// without the attachment the image would be broken
+			res.HTML = output.RemoveAttachedAvatar(res.HTML, userID)
+			continue
+		}
+		res.Images = append(res.Images, &mail.InlineImage{
+			ContentID:   output.AvatarContentID(userID),
+			ContentType: http.DetectContentType(author.Image),
+			Data:        author.Image,
+		})
+	}
+
+	return res
+}
@@ -0,0 +1,121 @@
+package delivery
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/backend"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/output"
+)
+
+const WebhookMethod = "webhook"
+
+// headers of the webhook requests. The signature is the hex encoded
+// HMAC-SHA256 of the timestamp, a dot and the request body, computed with the
+// configured secret. The timestamp (unix seconds) is signed so that receivers
+// can reject old requests that are sent again
+const (
+	WebhookSignatureHeader = "X-MAN-Signature"
+	WebhookTimestampHeader = "X-MAN-Timestamp"
+	WebhookVersionHeader   = "X-MAN-Version"
+)
+
+// requests with a timestamp older (or newer) than this should be rejected
+const WebhookSignatureTolerance = 5 * time.Minute
+
+const webhookTimeout = 10 * time.Second
+
+// posts the digest as a JSON document to an URL configured by the administrator
+type WebhookNotifier struct {
+	backend *backend.MattermostBackend
+	url     string
+	secret  string
+	client  *http.Client
+}
+
+func NewWebhookNotifier(backend *backend.MattermostBackend, url string, secret string) *WebhookNotifier {
+	return &WebhookNotifier{
+		backend: backend,
+		url:     url,
+		secret:  secret,
+		client:  &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+func (n *WebhookNotifier) Name() string { return WebhookMethod }
+
+func (n *WebhookNotifier) Render(missedActivity *model.TeamMissedActivity) (*Message, error) {
+	doc := output.BuildDigestDocument(n.backend, missedActivity)
+	if doc == nil {
+		return nil, nil
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "error serializing digest")
+	}
+	return &Message{Subject: doc.Title, Body: string(body)}, nil
+}
+
+// returns the signature of the request, as sent in the WebhookSignatureHeader header
+func SignWebhookRequest(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// checks the signature and the timestamp of a request, as receivers should do
+func VerifyWebhookRequest(secret string, signature string, timestamp string, body []byte, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Errorf("invalid timestamp '%s'", timestamp)
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > WebhookSignatureTolerance || age < -WebhookSignatureTolerance {
+		return errors.Errorf("timestamp '%s' out of tolerance", timestamp)
+	}
+	if !hmac.Equal([]byte(signature), []byte(SignWebhookRequest(secret, timestamp, body))) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func (n *WebhookNotifier) Send(_ *model.User, msg *Message) error {
+	body := []byte(msg.Body)
+
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "error creating webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookVersionHeader, strconv.Itoa(output.DigestDocumentVersion))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookRequest(n.secret, timestamp, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error calling webhook")
+	}
+	defer resp.Body.Close()
+
+	// drain the body to reuse the connection
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
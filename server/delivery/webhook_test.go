@@ -0,0 +1,46 @@
+package delivery
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSend(t *testing.T) {
+	var body []byte
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		headers = r.Header
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	msg := &Message{Subject: "Missed Activity", Body: `{"version":1}`}
+
+	webhook := NewWebhookNotifier(nil, server.URL, "secret")
+	require.NoError(t, webhook.Send(nil, msg))
+
+	assert.Equal(t, msg.Body, string(body))
+	assert.Equal(t, "application/json", headers.Get("Content-Type"))
+	assert.Equal(t, "1", headers.Get(WebhookVersionHeader))
+	timestamp := headers.Get(WebhookTimestampHeader)
+	signature := headers.Get(WebhookSignatureHeader)
+	assert.Equal(t, SignWebhookRequest("secret", timestamp, body), signature)
+	assert.NoError(t, VerifyWebhookRequest("secret", signature, timestamp, body, time.Now()))
+	assert.Error(t, VerifyWebhookRequest("other", signature, timestamp, body, time.Now()))
+	assert.Error(t, VerifyWebhookRequest("secret", signature, timestamp, []byte(`{"version":2}`), time.Now()))
+	// the timestamp is signed and old requests are rejected
+	assert.Error(t, VerifyWebhookRequest("secret", signature, "1700000000", body, time.Now()))
+	assert.Error(t, VerifyWebhookRequest("secret", signature, timestamp, body, time.Now().Add(10*time.Minute)))
+
+	failing := NewWebhookNotifier(nil, server.URL+"/fail", "secret")
+	assert.Error(t, failing.Send(nil, msg))
+}
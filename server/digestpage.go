@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/backend"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/i18n"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/man"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/output"
+)
+
+const digestPagePath = "/digest"
+
+const digestIndexPage = `<html><head><meta charset="utf-8"><title>%s</title></head>
+<body style="font-family: sans-serif; max-width: 600px; margin: 40px auto;">
+<h2>%s</h2>
+%s
+<h2>%s</h2>
+%s
+</body></html>`
+
+// returns the web version of the digest, to be archived once the digest has
+// been sent. It returns nil if it cannot be rendered
+func (p *MANPlugin) buildArchivedDigest(missedActivity *model.TeamMissedActivity, webProps *output.EmailTemplateProps) *model.ArchivedDigest {
+	subject, body, err := output.BuildHTMLEmail(p.backend, missedActivity, webProps)
+	if err != nil || body == "" {
+		p.backend.LogError("Error rendering the web version of the digest for user %s: %v", missedActivity.User.Username, err)
+		return nil
+	}
+
+	return &model.ArchivedDigest{
+		ID:        missedActivity.DigestID,
+		TeamID:    missedActivity.Team.ID,
+		TeamName:  missedActivity.Team.Name,
+		Subject:   subject,
+		CreatedAt: time.Now().UnixMilli(),
+		HTML:      body,
+	}
+}
+
+// stores the web version of a digest sent to the user. Errors are only
+// logged, since the digest has been already sent
+func (p *MANPlugin) archiveDigest(userID string, digest *model.ArchivedDigest) {
+	if errA := p.backend.ArchiveDigest(userID, digest); errA != nil {
+		p.backend.LogError("Error archiving the digest for user %s: %s", userID, errA)
+	}
+}
+
+// returns the current missed activity of the user, in all teams
+func (p *MANPlugin) getCurrentMissedActivity(user *model.User) ([]*model.TeamMissedActivity, error) {
+	lastNotifiedTimestamp, errT := p.backend.GetLastNotifiedTimestamp()
+	if errT != nil {
+		return nil, errT
+	}
+
+	lowerBound := time.UnixMilli(0)
+	if p.configuration.NotifyOnlyNewMessagesFromStartup {
+		lowerBound = p.startupTime
+	}
+
+	result, err := man.RunMAN(p.backend, p.userStatuses, &man.MissedActivityOptions{
+		LowerBound:            lowerBound,
+		LastNotifiedTimestamp: lastNotifiedTimestamp,
+		UpperBound:            time.Now(),
+		RunTime:               time.Now(),
+		IgnoreSchedules:       true,
+		DisabledFilters:       p.configuration.GetDisabledFilters(),
+		NotifiedByMMTypes:     p.configuration.GetAlreadyNotifiedBy(),
+		Concurrency:           p.configuration.MaxConcurrency,
+		UserIDs:               []string{user.ID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Errors) > 0 {
+		return nil, result.Errors[0]
+	}
+	return result.Activities, nil
+}
+
+func writeDigestPageError(w http.ResponseWriter, status int, locale string, id string) {
+	title := html.EscapeString(i18n.T(locale, "web.title"))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, actionPage, title, title, html.EscapeString(i18n.T(locale, id)), "")
+}
+
+// shows the digests of the user logged in Mattermost in the browser:
+//   - ?id=<id> a past digest, linked from the emails
+//   - ?team=<team id> the current missed activity in the team (empty for direct messages)
+//   - otherwise the list of the teams with missed activity and of the past digests
+func (p *MANPlugin) serveDigestPage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		redirect := "/plugins/" + backend.PluginID + digestPagePath
+		if r.URL.RawQuery != "" {
+			redirect += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, fmt.Sprintf("%s/login?redirect_to=%s", p.backend.GetServerURL(), url.QueryEscape(redirect)), http.StatusFound)
+		return
+	}
+
+	user, errU := p.backend.GetUser(userID)
+	if errU != nil {
+		p.backend.LogError("Error getting user %s: %s", userID, errU)
+		writeDigestPageError(w, http.StatusInternalServerError, i18n.DefaultLocale, "web.error")
+		return
+	}
+
+	query := r.URL.Query()
+
+	if query.Has("id") {
+		digests, errD := p.backend.GetArchivedDigests(user.ID)
+		if errD != nil {
+			p.backend.LogError("Error getting the digests of user %s: %s", user.Username, errD)
+			writeDigestPageError(w, http.StatusInternalServerError, user.Locale, "web.error")
+			return
+		}
+		for _, d := range digests {
+			if d.ID == query.Get("id") {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				fmt.Fprint(w, d.HTML)
+				return
+			}
+		}
+		writeDigestPageError(w, http.StatusNotFound, user.Locale, "web.not_found")
+		return
+	}
+
+	current, errC := p.getCurrentMissedActivity(user)
+	if errC != nil {
+		p.backend.LogError("Error getting the missed activity of user %s: %s", user.Username, errC)
+		writeDigestPageError(w, http.StatusInternalServerError, user.Locale, "web.error")
+		return
+	}
+
+	webProps := p.getEmailTemplateProps()
+	webProps.WebPage = true
+
+	if query.Has("team") {
+		for _, ma := range current {
+			if ma.Team.ID != query.Get("team") || ma.IsEmpty() {
+				continue
+			}
+			_, body, errB := output.BuildHTMLEmail(p.backend, ma, webProps)
+			if errB != nil {
+				p.backend.LogError("Error rendering the missed activity of user %s: %s", user.Username, errB)
+				writeDigestPageError(w, http.StatusInternalServerError, user.Locale, "web.error")
+				return
+			}
+			if body != "" {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				fmt.Fprint(w, body)
+				return
+			}
+		}
+		writeDigestPageError(w, http.StatusOK, user.Locale, "web.current.none")
+		return
+	}
+
+	currentList := ""
+	for _, ma := range current {
+		if ma.IsEmpty() {
+			continue
+		}
+		currentList += fmt.Sprintf(`<li><a href="?team=%s">%s</a></li>`, url.QueryEscape(ma.Team.ID), html.EscapeString(output.DigestTitle(p.backend, ma)))
+	}
+	if currentList == "" {
+		currentList = "<p>" + html.EscapeString(i18n.T(user.Locale, "web.current.none")) + "</p>"
+	} else {
+		currentList = "<ul>" + currentList + "</ul>"
+	}
+
+	digests, errD := p.backend.GetArchivedDigests(user.ID)
+	if errD != nil {
+		p.backend.LogError("Error getting the digests of user %s: %s", user.Username, errD)
+	}
+	pastList := ""
+	for i := len(digests) - 1; i >= 0; i-- {
+		d := digests[i]
+		pastList += fmt.Sprintf(`<li>%s <a href="?id=%s">%s</a></li>`,
+			html.EscapeString(time.UnixMilli(d.CreatedAt).In(user.Location()).Format("Mon Jan 2 15:04")), url.QueryEscape(d.ID), html.EscapeString(d.Subject))
+	}
+	if pastList == "" {
+		pastList = "<p>" + html.EscapeString(i18n.T(user.Locale, "web.past.none")) + "</p>"
+	} else {
+		pastList = "<ul>" + pastList + "</ul>"
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, digestIndexPage,
+		html.EscapeString(i18n.T(user.Locale, "web.title")),
+		html.EscapeString(i18n.T(user.Locale, "web.current")), currentList,
+		html.EscapeString(i18n.T(user.Locale, "web.past")), pastList)
+}
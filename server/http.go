@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mattermost/mattermost/server/public/plugin"
@@ -41,10 +42,16 @@ func (p *MANPlugin) manualRun(buf http.ResponseWriter, lower time.Time, upper ti
 	if p.configuration.NotifyOnlyNewMessagesFromStartup {
 		lowerBound = p.startupTime
 	}
-	res, err := man.RunMAN(p.backend, p.userStatuses, &man.MissedActivityOptions{
-		LowerBound:            lowerBound,
-		LastNotifiedTimestamp: lower,
-		UpperBound:            upper,
+	result, err := man.RunMAN(p.backend, p.userStatuses, &man.MissedActivityOptions{
+		LowerBound:                        lowerBound,
+		LastNotifiedTimestamp:             lower,
+		UpperBound:                        upper,
+		IgnoreUsersLastNotifiedTimestamps: true,
+		RunTime:                           time.Now(),
+		IgnoreSchedules:                   true,
+		DisabledFilters:                   p.configuration.GetDisabledFilters(),
+		NotifiedByMMTypes:                 p.configuration.GetAlreadyNotifiedBy(),
+		Concurrency:                       p.configuration.MaxConcurrency,
 	})
 
 	if err != nil {
@@ -52,18 +59,18 @@ func (p *MANPlugin) manualRun(buf http.ResponseWriter, lower time.Time, upper ti
 		return
 	}
 
-	for _, r := range res {
-		out := output.PrintTeamMissedActivity(p.backend, r)
-		fmt.Fprintf(buf, "<pre>%s</pre><br/>", out)
-		emailConfig := &output.EmailTemplateProps{
-			SubTitle:    p.configuration.EmailSubTitle,
-			ButtonText:  p.configuration.EmailButtonText,
-			FooterLine1: p.configuration.EmailFooterLine1,
-			FooterLine2: p.configuration.EmailFooterLine2,
-			FooterLine3: p.configuration.EmailFooterLine3,
+	for _, runErr := range result.Errors {
+		fmt.Fprintf(buf, "<pre>Error: %s</pre><br/>", runErr)
+	}
+
+	for _, r := range result.Activities {
+		if r.IsEmpty() {
+			continue
 		}
 
-		subject, email, err := output.BuildHTMLEmail(p.backend, r, emailConfig)
+		out := output.PrintTeamMissedActivity(p.backend, r)
+		fmt.Fprintf(buf, "<pre>%s</pre><br/>", out)
+		subject, email, err := output.BuildHTMLEmail(p.backend, r, p.getEmailTemplateProps())
 		if err != nil {
 			fmt.Fprintf(buf, "<strong>Error building email: %s</strong>", err)
 		} else {
@@ -73,6 +80,29 @@ func (p *MANPlugin) manualRun(buf http.ResponseWriter, lower time.Time, upper ti
 }
 
 func (p *MANPlugin) ServeHTTP(_ *plugin.Context, w http.ResponseWriter, r *http.Request) {
+	// pages for users, authenticated by Mattermost
+	if r.URL.Path == "/unsubscribe" {
+		p.serveUnsubscribe(w, r)
+		return
+	}
+	if r.URL.Path == channelsAutocompletePath {
+		p.serveChannelsAutocomplete(w, r)
+		return
+	}
+	if r.URL.Path == digestPagePath {
+		p.serveDigestPage(w, r)
+		return
+	}
+	// signed links in the digests, authenticated by their token
+	if r.URL.Path == "/action" {
+		p.serveAction(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, templatesAPIPath) {
+		p.serveTemplatesAPI(w, r)
+		return
+	}
+
 	configToken := p.getConfiguration().DebugHTTPToken
 	if configToken == "" || r.Header.Get("X-Debug-Token") != configToken {
 		fmt.Fprint(w, "invalid token")
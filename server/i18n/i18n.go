@@ -0,0 +1,102 @@
+// Package i18n translates the texts of the plugin in the locale of the users.
+// Translations are in the json catalogs in the locales directory, indexed by
+// message id. Messages missing in a catalog are taken from the default locale
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mergestat/timediff"
+	"github.com/mergestat/timediff/locale"
+)
+
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var catalogFiles embed.FS
+
+// messages by locale and message id
+var catalogs = map[string]map[string]string{}
+
+func init() {
+	files, err := catalogFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, f := range files {
+		content, errR := catalogFiles.ReadFile(path.Join("locales", f.Name()))
+		if errR != nil {
+			panic(errR)
+		}
+		messages := map[string]string{}
+		if errU := json.Unmarshal(content, &messages); errU != nil {
+			panic(fmt.Sprintf("invalid catalog %s: %s", f.Name(), errU))
+		}
+		catalogs[strings.TrimSuffix(f.Name(), ".json")] = messages
+	}
+}
+
+// returns the locales with a catalog
+func Locales() []string {
+	res := make([]string, 0, len(catalogs))
+	for l := range catalogs {
+		res = append(res, l)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// returns the locale of the catalog to use for the given locale. Locales
+// with a territory (e.g. "it-IT" or "pt_BR") fall back to the language
+func resolve(loc string) string {
+	if _, ok := catalogs[loc]; ok {
+		return loc
+	}
+	lang, _ := locale.Locale(loc).Split()
+	if _, ok := catalogs[lang]; ok {
+		return lang
+	}
+	return DefaultLocale
+}
+
+// returns the message with the given id translated in the locale and
+// formatted with the arguments (as in fmt.Sprintf)
+func T(loc string, id string, args ...any) string {
+	message, ok := catalogs[resolve(loc)][id]
+	if !ok {
+		message, ok = catalogs[DefaultLocale][id]
+	}
+	if !ok {
+		return id
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// as T, but chooses between the "<id>.one" and the "<id>.other" messages
+// according to n, that is passed as first argument
+func N(loc string, id string, n int, args ...any) string {
+	suffix := ".other"
+	if n == 1 {
+		suffix = ".one"
+	}
+	return T(loc, id+suffix, append([]any{n}, args...)...)
+}
+
+// returns how long ago the time was, in the locale
+func TimeDiff(loc string, t time.Time) string {
+	res := timediff.TimeDiff(t, timediff.WithLocale(locale.Locale(resolve(loc))))
+	if res == "" {
+		// the locale is not supported by timediff
+		res = timediff.TimeDiff(t)
+	}
+	return res
+}
@@ -0,0 +1,60 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalogsHaveAllMessages(t *testing.T) {
+	for _, loc := range Locales() {
+		for id := range catalogs[DefaultLocale] {
+			_, ok := catalogs[loc][id]
+			assert.True(t, ok, "message %s missing in locale %s", id, loc)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	assert.Equal(t, "Missed Activity in the Dev team", T("en", "digest.title.team", "Dev"))
+	assert.Equal(t, "Attività non lette nel team Dev", T("it", "digest.title.team", "Dev"))
+
+	// territories fall back to the language, unknown locales to English
+	assert.Equal(t, "Attività non lette nel team Dev", T("it-IT", "digest.title.team", "Dev"))
+	assert.Equal(t, "Missed Activity in the Dev team", T("de", "digest.title.team", "Dev"))
+	assert.Equal(t, "Missed Activity in the Dev team", T("", "digest.title.team", "Dev"))
+
+	// unknown messages
+	assert.Equal(t, "no.such.message", T("it", "no.such.message"))
+}
+
+func TestN(t *testing.T) {
+	assert.Equal(t, "1 reply in not followed threads", N("en", "digest.counter.replies_not_followed", 1))
+	assert.Equal(t, "3 risposte in discussioni che non segui", N("it", "digest.counter.replies_not_followed", 3))
+}
+
+func TestTimeDiff(t *testing.T) {
+	assert.Equal(t, "2 hours ago", TimeDiff("en", time.Now().Add(-2*time.Hour)))
+	assert.Equal(t, "2 ore fa", TimeDiff("it", time.Now().Add(-2*time.Hour)))
+}
+
+func TestFormatTime(t *testing.T) {
+	rome, _ := time.LoadLocation("Europe/Rome")
+	// Thursday
+	now := time.Date(2023, 11, 16, 10, 0, 0, 0, rome)
+
+	assert.Equal(t, "Today 09:12", FormatTime("en", time.Date(2023, 11, 16, 9, 12, 0, 0, rome), now, rome, true))
+	assert.Equal(t, "Today 9:12 AM", FormatTime("en", time.Date(2023, 11, 16, 9, 12, 0, 0, rome), now, rome, false))
+	assert.Equal(t, "Yesterday 4:40 PM", FormatTime("en", time.Date(2023, 11, 15, 16, 40, 0, 0, rome), now, rome, false))
+	assert.Equal(t, "Mon 09:12", FormatTime("en", time.Date(2023, 11, 13, 9, 12, 0, 0, rome), now, rome, true))
+	assert.Equal(t, "Nov 2 09:12", FormatTime("en", time.Date(2023, 11, 2, 9, 12, 0, 0, rome), now, rome, true))
+	assert.Equal(t, "Dec 30, 2022 09:12", FormatTime("en", time.Date(2022, 12, 30, 9, 12, 0, 0, rome), now, rome, true))
+	assert.Equal(t, "Ieri 16:40", FormatTime("it", time.Date(2023, 11, 15, 16, 40, 0, 0, rome), now, rome, true))
+	assert.Equal(t, "2 nov 09:12", FormatTime("it", time.Date(2023, 11, 2, 9, 12, 0, 0, rome), now, rome, true))
+
+	// the day is the day in the timezone of the reader
+	utcTime := time.Date(2023, 11, 15, 23, 30, 0, 0, time.UTC)
+	assert.Equal(t, "Today 00:30", FormatTime("en", utcTime, now, rome, true))
+	assert.Equal(t, "Yesterday 23:30", FormatTime("en", utcTime, now, time.UTC, true))
+}
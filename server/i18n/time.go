@@ -0,0 +1,40 @@
+package i18n
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// formats the time of a message for the reader, in the given timezone and
+// with a 12 or 24 hours clock. Messages of the last week are shown with the
+// time of the day ("Today 16:40", "Yesterday 16:40", "Mon 09:12"), older
+// messages with the date
+func FormatTime(loc string, t time.Time, now time.Time, location *time.Location, military bool) string {
+	t = t.In(location)
+	now = now.In(location)
+
+	clock := t.Format("3:04 PM")
+	if military {
+		clock = t.Format("15:04")
+	}
+
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	// rounded, since days with a DST change are not 24 hours long
+	days := int(math.Round(today.Sub(day).Hours() / 24))
+
+	month := T(loc, "time.month."+strings.ToLower(t.Month().String()[:3]))
+
+	switch {
+	case days <= 0:
+		return T(loc, "time.today", clock)
+	case days == 1:
+		return T(loc, "time.yesterday", clock)
+	case days < 7:
+		return T(loc, "time.weekday", T(loc, "time.weekday."+strings.ToLower(t.Weekday().String()[:3])), clock)
+	case t.Year() == now.Year():
+		return T(loc, "time.date", t.Day(), month, clock)
+	}
+	return T(loc, "time.date_year", t.Day(), month, t.Year(), clock)
+}
@@ -4,10 +4,14 @@ import (
 	"fmt"
 	"time"
 
+	mm_model "github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/pluginapi/cluster"
 	"github.com/pkg/errors"
 
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/backend"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/delivery"
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/man"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/output"
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/userstatus"
 )
@@ -67,6 +71,12 @@ func (p *MANPlugin) CleanMANStats() {
 	}
 }
 
+func setUserLastNotifiedTimestamp(timestamps *backend.RunTimestamps, missedActivity *model.TeamMissedActivity, value time.Time) {
+	for _, team := range missedActivity.GetTeams() {
+		timestamps.SetUserLastNotified(missedActivity.User.ID, team.ID, value)
+	}
+}
+
 func (p *MANPlugin) MANJob() {
 	// 1. calculate the time range in which run
 	lastNotifiedTimestamp, errT := p.backend.GetLastNotifiedTimestamp()
@@ -80,13 +90,18 @@ func (p *MANPlugin) MANJob() {
 		lowerBound = p.startupTime
 	}
 
-	upper := time.Now().Add(time.Minute * (-time.Duration(p.configuration.IgnoreMessagesNewerThan)))
+	runTime := time.Now()
+	upper := runTime.Add(time.Minute * (-time.Duration(p.configuration.IgnoreMessagesNewerThan)))
 
 	// 2. run MAN. This will return a list of TeamMissedActivity objects
-	res, err := man.RunMAN(p.backend, p.userStatuses, &man.MissedActivityOptions{
+	result, err := man.RunMAN(p.backend, p.userStatuses, &man.MissedActivityOptions{
 		LowerBound:            lowerBound,
 		LastNotifiedTimestamp: lastNotifiedTimestamp,
 		UpperBound:            upper,
+		RunTime:               runTime,
+		DisabledFilters:       p.configuration.GetDisabledFilters(),
+		NotifiedByMMTypes:     p.configuration.GetAlreadyNotifiedBy(),
+		Concurrency:           p.configuration.MaxConcurrency,
 	})
 
 	if err != nil {
@@ -103,47 +118,112 @@ func (p *MANPlugin) MANJob() {
 		htmlEmails:    []string{},
 	}
 
-	// 3. for each TeamMissedActivity
+	// 3. retry digests that could not be sent in previous runs
+	if !p.configuration.DryRun {
+		p.processOutbox(execLogs)
+	}
+
+	notifiers := p.getNotifiers()
+
+	// props used to render the digests for the web page
+	webProps := p.getEmailTemplateProps()
+	webProps.WebPage = true
+
+	// 4. for each TeamMissedActivity
 	//    - render in plain text and save in stats
 	//    - build the email html text and save in stats
 	//    - send the email
 
-	for _, r := range res {
+	// changes to the users timestamps, saved at the end of the run
+	timestamps := backend.NewRunTimestamps()
+
+	// users processed in this run. The value is false if the missed
+	// activity of the user has not been notified in at least one team
+	processedUsers := map[string]bool{}
+	for _, user := range result.ProcessedUsers {
+		processedUsers[user.ID] = true
+	}
+
+	// users not due or deferred are notified in a next run: they keep the
+	// current last notified timestamp for the teams in which they have never
+	// been notified
+	for _, user := range result.SkippedUsers {
+		timestamps.KeepUserLastNotified(user.ID, lastNotifiedTimestamp)
+	}
+
+	// users whose missed activity could not be computed are retried in the
+	// next run: their last processed and last notified timestamps are not
+	// advanced (the missed activity computed in other teams is still sent)
+	for _, runErr := range result.Errors {
+		processedUsers[runErr.User.ID] = false
+		execLogs.textLogs = append(execLogs.textLogs, fmt.Sprintf("Error: %s", runErr))
+	}
+
+	for _, r := range result.Activities {
+		// nothing to notify, the user is up to date in this team
+		if r.IsEmpty() {
+			setUserLastNotifiedTimestamp(timestamps, r, upper)
+			continue
+		}
+
 		// record text logs
 		out := output.PrintTeamMissedActivity(p.backend, r)
 		execLogs.textLogs = append(execLogs.textLogs, out)
 
-		emailConfig := &output.EmailTemplateProps{
-			SubTitle:    p.configuration.EmailSubTitle,
-			ButtonText:  p.configuration.EmailButtonText,
-			FooterLine1: p.configuration.EmailFooterLine1,
-			FooterLine2: p.configuration.EmailFooterLine2,
-			FooterLine3: p.configuration.EmailFooterLine3,
+		notifier := notifiers.Get(r.User.MANPreferences.DeliveryMethod)
+
+		// digests sent are archived, so they can be viewed in the browser
+		if !p.configuration.DryRun {
+			r.DigestID = mm_model.NewId()
 		}
 
-		subject, email, errM := output.BuildHTMLEmail(p.backend, r, emailConfig)
+		msg, errM := notifier.Render(r)
 		if errM != nil {
-			p.backend.LogError("Cannot send email! Error building email: %s", errM)
+			p.backend.LogError("Cannot send digest! Error rendering digest: %s", errM)
+			processedUsers[r.User.ID] = false
 			continue
 		}
 
-		if email != "" {
+		if msg != nil {
 			// record email logs
-			execLogs.htmlEmails = append(execLogs.htmlEmails, fmt.Sprintf("To: %s Subject: %s Body: <br>%s", r.User.Email, subject, email))
+			execLogs.htmlEmails = append(execLogs.htmlEmails, fmt.Sprintf("Via: %s To: %s Subject: %s Body: <br>%s", notifier.Name(), r.User.Email, msg.Subject, msg.Body))
 			if entry, ok := p.manRunStats.sentEmailStats[r.User.ID]; ok {
 				p.manRunStats.sentEmailStats[r.User.ID] = append(entry, time.Now())
 			} else {
 				p.manRunStats.sentEmailStats[r.User.ID] = []time.Time{time.Now()}
 			}
 
-			// send email
+			// send digest
 			if !p.configuration.DryRun {
-				errE := p.backend.SendEmailToUser(r.User, subject, email)
+				// the web version is archived only once the digest has been sent
+				archived := p.buildArchivedDigest(r, webProps)
+
+				errE := notifier.Send(r.User, msg)
 				if errE != nil {
-					p.backend.LogError("Cannot send email! Error sending email: %s", errE)
+					p.backend.LogError("Cannot send digest! Error sending digest via %s: %s", notifier.Name(), errE)
+
+					// the digest is stored in the outbox and retried in the next runs
+					errQ := p.enqueueDigest(r, notifier.Name(), msg, archived, errE)
+					if errQ != nil {
+						// do not update the user's last notified timestamp, so
+						// the missed activity will be notified again in the next run
+						p.backend.LogError("Cannot store email in the outbox: %s", errQ)
+						processedUsers[r.User.ID] = false
+						continue
+					}
+					execLogs.textLogs = append(execLogs.textLogs, fmt.Sprintf("Outbox: error sending digest '%s' to user %s, it will be retried: %s", msg.Subject, r.User.Username, errE))
+				} else if archived != nil {
+					p.archiveDigest(r.User.ID, archived)
 				}
 			}
 		}
+
+		// the webhook receives all digests, whatever the delivery method of the user
+		if webhook, ok := notifiers.Lookup(delivery.WebhookMethod); ok {
+			p.sendToWebhook(webhook, r, execLogs)
+		}
+
+		setUserLastNotifiedTimestamp(timestamps, r, upper)
 	}
 
 	// notice in the logs if running in dry run mode
@@ -151,17 +231,32 @@ func (p *MANPlugin) MANJob() {
 		p.backend.LogWarn("MAN plugin did not sent emails because it is running in DryRun mode. Please disable it to start sending emails")
 	}
 
-	// 4. update the stats with the new run
+	// users notified in all their teams will not be processed again until
+	// the next delivery time of their schedule. The others keep the current
+	// last notified timestamp, like the skipped users
+	notifiedUsers := []string{}
+	for userID, notified := range processedUsers {
+		if notified {
+			notifiedUsers = append(notifiedUsers, userID)
+		} else {
+			timestamps.KeepUserLastNotified(userID, lastNotifiedTimestamp)
+		}
+	}
+	timestamps.SetUsersProcessed(notifiedUsers, runTime)
+
+	// 5. update the stats with the new run
 	p.manRunStats.runLogs = append(p.manRunStats.runLogs, *execLogs)
 	p.manRunStats.numRuns++
 
-	// 5. record the last notified timestamp in the db
-	errST := p.backend.SetLastNotifiedTimestamp(upper)
+	// 6. record the timestamps of the users and the last notified timestamp
+	//    in the db. It is the time of the last run and it is used for users
+	//    never notified before
+	errST := p.backend.SaveRunTimestamps(timestamps, upper)
 	if errST != nil {
-		p.backend.LogError("Error setting lastNotifiedTimestamp: %s", errST)
+		p.backend.LogError("Error saving the timestamps of the run: %s", errST)
 	}
 
-	// 6. housekeeping
+	// 7. housekeeping
 	p.CleanMANStats()
 	// remove statuses older than the last run because we will not need them
 	userstatus.ClearStatusesOlderThan(p.userStatuses, time.Now().Add(time.Hour*(-time.Duration(p.configuration.KeepStatusHistoryInterval))))
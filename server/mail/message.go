@@ -0,0 +1,170 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// an image attached to the message and referenced in the html part with "cid:<ContentID>"
+type InlineImage struct {
+	ContentID   string
+	ContentType string
+	Data        []byte
+}
+
+// an email with a plain text and an html version of the same content
+type Message struct {
+	FromName    string
+	FromAddress string
+	To          string
+	Subject     string
+	Text        string
+	HTML        string
+	Images      []*InlineImage
+	// additional headers
+	Headers map[string]string
+}
+
+func writeHeader(w io.Writer, name string, value string) {
+	fmt.Fprintf(w, "%s: %s\r\n", name, value)
+}
+
+// returns the message encoded as multipart/alternative (wrapped in a
+// multipart/related if there are inline images), ready to be sent with SMTP
+func (m *Message) Bytes() ([]byte, error) {
+	w := new(bytes.Buffer)
+
+	from := mail.Address{Name: m.FromName, Address: m.FromAddress}
+	to := mail.Address{Address: m.To}
+
+	writeHeader(w, "From", from.String())
+	writeHeader(w, "To", to.String())
+	writeHeader(w, "Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader(w, "Date", time.Now().Format(time.RFC1123Z))
+	writeHeader(w, "MIME-Version", "1.0")
+
+	// sorted to produce always the same message
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeHeader(w, name, m.Headers[name])
+	}
+
+	alternative := new(bytes.Buffer)
+	aw := multipart.NewWriter(alternative)
+
+	// the preferred version is the last one
+	if err := writeTextPart(aw, "text/plain; charset=UTF-8", m.Text); err != nil {
+		return nil, err
+	}
+	if err := writeTextPart(aw, "text/html; charset=UTF-8", m.HTML); err != nil {
+		return nil, err
+	}
+	if err := aw.Close(); err != nil {
+		return nil, errors.Wrap(err, "error closing multipart message")
+	}
+	alternativeType := fmt.Sprintf("multipart/alternative; boundary=%q", aw.Boundary())
+
+	if len(m.Images) == 0 {
+		writeHeader(w, "Content-Type", alternativeType)
+		w.WriteString("\r\n")
+		w.Write(alternative.Bytes())
+		return w.Bytes(), nil
+	}
+
+	related := new(bytes.Buffer)
+	rw := multipart.NewWriter(related)
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", alternativeType)
+	pw, err := rw.CreatePart(header)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating message part")
+	}
+	if _, err = pw.Write(alternative.Bytes()); err != nil {
+		return nil, errors.Wrap(err, "error writing message part")
+	}
+
+	for _, img := range m.Images {
+		if err = writeImagePart(rw, img); err != nil {
+			return nil, err
+		}
+	}
+	if err = rw.Close(); err != nil {
+		return nil, errors.Wrap(err, "error closing multipart message")
+	}
+
+	writeHeader(w, "Content-Type", fmt.Sprintf("multipart/related; type=\"multipart/alternative\"; boundary=%q", rw.Boundary()))
+	w.WriteString("\r\n")
+	w.Write(related.Bytes())
+	return w.Bytes(), nil
+}
+
+func writeTextPart(mw *multipart.Writer, contentType string, content string) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	pw, err := mw.CreatePart(header)
+	if err != nil {
+		return errors.Wrap(err, "error creating message part")
+	}
+
+	qw := quotedprintable.NewWriter(pw)
+	if _, err := qw.Write([]byte(content)); err != nil {
+		return errors.Wrap(err, "error writing message part")
+	}
+	return qw.Close()
+}
+
+// max length of base64 lines (RFC 2045)
+const base64LineLength = 76
+
+func writeImagePart(mw *multipart.Writer, img *InlineImage) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", img.ContentType)
+	header.Set("Content-Transfer-Encoding", "base64")
+	header.Set("Content-ID", "<"+img.ContentID+">")
+	header.Set("Content-Disposition", "inline")
+
+	pw, err := mw.CreatePart(header)
+	if err != nil {
+		return errors.Wrap(err, "error creating image part")
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(img.Data)
+	for len(encoded) > 0 {
+		n := base64LineLength
+		if len(encoded) < n {
+			n = len(encoded)
+		}
+		if _, err := io.WriteString(pw, encoded[:n]+"\r\n"); err != nil {
+			return errors.Wrap(err, "error writing image part")
+		}
+		encoded = encoded[n:]
+	}
+	return nil
+}
+
+// returns a new unique message id for the host, including the angle brackets
+func NewMessageID(host string) string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("<%s.%d@%s>", hex.EncodeToString(b), time.Now().UnixNano(), host)
+}
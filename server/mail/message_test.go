@@ -0,0 +1,55 @@
+package mail
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageBytes(t *testing.T) {
+	msg := &Message{
+		FromName:    "Mattermost",
+		FromAddress: "noreply@example.com",
+		To:          "user@example.com",
+		Subject:     "Missed activity ✉",
+		Text:        "plain text version",
+		HTML:        "<p>html version</p>",
+		Headers:     map[string]string{"Reply-To": "admin@example.com"},
+	}
+
+	data, err := msg.Bytes()
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	assert.Equal(t, msg.Subject, subject)
+	assert.Equal(t, "admin@example.com", parsed.Header.Get("Reply-To"))
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	contents := map[string]string{}
+	for {
+		part, errP := mr.NextPart()
+		if errP == io.EOF {
+			break
+		}
+		require.NoError(t, errP)
+		// the reader decodes quoted-printable parts
+		content, _ := io.ReadAll(part)
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		contents[contentType] = string(content)
+	}
+
+	assert.Equal(t, map[string]string{"text/plain": msg.Text, "text/html": msg.HTML}, contents)
+}
@@ -0,0 +1,111 @@
+package mail
+
+import (
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// connection security values, as in the Mattermost email settings
+const (
+	SecurityNone     = ""
+	SecurityTLS      = "TLS"
+	SecurityStartTLS = "STARTTLS"
+)
+
+type SMTPSettings struct {
+	Server             string
+	Port               string
+	ConnectionSecurity string
+	Auth               bool
+	Username           string
+	Password           string
+	SkipCertVerify     bool
+	Timeout            time.Duration
+}
+
+// PLAIN authentication that works also on unencrypted connections, if the
+// administrator configured Mattermost this way (smtp.PlainAuth refuses them)
+type plainAuth struct {
+	username string
+	password string
+}
+
+func (a *plainAuth) Start(_ *smtp.ServerInfo) (string, []byte, error) {
+	return "PLAIN", []byte("\x00" + a.username + "\x00" + a.password), nil
+}
+
+func (a *plainAuth) Next(_ []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, errors.New("unexpected server challenge")
+	}
+	return nil, nil
+}
+
+// sends the message with SMTP
+func Send(settings *SMTPSettings, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(settings.Server, settings.Port)
+	tlsConfig := &tls.Config{
+		ServerName: settings.Server,
+		//nolint:gosec
+		InsecureSkipVerify: settings.SkipCertVerify,
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, settings.Timeout)
+	if err != nil {
+		return errors.Wrap(err, "error connecting to the smtp server")
+	}
+	if settings.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(settings.Timeout))
+	}
+	if settings.ConnectionSecurity == SecurityTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, settings.Server)
+	if err != nil {
+		conn.Close()
+		return errors.Wrap(err, "error creating smtp client")
+	}
+	defer c.Close()
+
+	if settings.ConnectionSecurity == SecurityStartTLS {
+		if err = c.StartTLS(tlsConfig); err != nil {
+			return errors.Wrap(err, "error starting tls")
+		}
+	}
+
+	if settings.Auth {
+		if err = c.Auth(&plainAuth{username: settings.Username, password: settings.Password}); err != nil {
+			return errors.Wrap(err, "error authenticating to the smtp server")
+		}
+	}
+
+	if err = c.Mail(msg.FromAddress); err != nil {
+		return errors.Wrap(err, "error setting the sender")
+	}
+	if err = c.Rcpt(msg.To); err != nil {
+		return errors.Wrap(err, "error setting the recipient")
+	}
+
+	wc, err := c.Data()
+	if err != nil {
+		return errors.Wrap(err, "error starting the message")
+	}
+	if _, err = wc.Write(data); err != nil {
+		return errors.Wrap(err, "error writing the message")
+	}
+	if err = wc.Close(); err != nil {
+		return errors.Wrap(err, "error sending the message")
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,142 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// what the fake smtp server received
+type smtpSession struct {
+	auth string
+	from string
+	to   string
+	data []byte
+}
+
+// starts a minimal smtp server that accepts a single message
+func startSMTPStandIn(t *testing.T) (string, chan *smtpSession) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	sessions := make(chan *smtpSession, 1)
+	go func() {
+		conn, errA := l.Accept()
+		if errA != nil {
+			return
+		}
+		defer conn.Close()
+
+		tc := textproto.NewConn(conn)
+		session := &smtpSession{}
+		_ = tc.PrintfLine("220 localhost ESMTP")
+		for {
+			line, errR := tc.ReadLine()
+			if errR != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch cmd {
+			case "EHLO", "HELO":
+				_ = tc.PrintfLine("250-localhost")
+				_ = tc.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				session.auth = strings.TrimPrefix(line, "AUTH PLAIN ")
+				_ = tc.PrintfLine("235 2.7.0 Authentication successful")
+			case "MAIL":
+				session.from = line
+				_ = tc.PrintfLine("250 OK")
+			case "RCPT":
+				session.to = line
+				_ = tc.PrintfLine("250 OK")
+			case "DATA":
+				_ = tc.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+				session.data, _ = tc.ReadDotBytes()
+				_ = tc.PrintfLine("250 OK")
+			case "QUIT":
+				_ = tc.PrintfLine("221 Bye")
+				sessions <- session
+				return
+			default:
+				_ = tc.PrintfLine("502 Command not implemented")
+			}
+		}
+	}()
+
+	return l.Addr().String(), sessions
+}
+
+func TestSend(t *testing.T) {
+	addr, sessions := startSMTPStandIn(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	avatar := []byte("\x89PNG\r\n\x1a\nfake image")
+	msg := &Message{
+		FromName:    "Mattermost",
+		FromAddress: "noreply@example.com",
+		To:          "user@example.com",
+		Subject:     "Recent activity",
+		Text:        "text",
+		HTML:        `<img src="cid:avatar-1@man">`,
+		Images:      []*InlineImage{{ContentID: "avatar-1@man", ContentType: "image/png", Data: avatar}},
+		Headers: map[string]string{
+			"Message-ID":       NewMessageID("example.com"),
+			"References":       "<digest.1.2@example.com>",
+			"List-Unsubscribe": "<https://example.com/unsubscribe>",
+		},
+	}
+
+	err := Send(&SMTPSettings{Server: host, Port: port, Auth: true, Username: "man", Password: "secret", Timeout: 5 * time.Second}, msg)
+	require.NoError(t, err)
+
+	var session *smtpSession
+	select {
+	case session = <-sessions:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("\x00man\x00secret")), session.auth)
+	assert.Equal(t, "MAIL FROM:<noreply@example.com>", session.from)
+	assert.Equal(t, "RCPT TO:<user@example.com>", session.to)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(session.data))
+	require.NoError(t, err)
+	assert.Equal(t, msg.Headers["Message-ID"], parsed.Header.Get("Message-ID"))
+	assert.Equal(t, "<digest.1.2@example.com>", parsed.Header.Get("References"))
+	assert.Equal(t, "<https://example.com/unsubscribe>", parsed.Header.Get("List-Unsubscribe"))
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/related", mediaType)
+
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+
+	alternative, err := mr.NextPart()
+	require.NoError(t, err)
+	alternativeType, _, _ := mime.ParseMediaType(alternative.Header.Get("Content-Type"))
+	assert.Equal(t, "multipart/alternative", alternativeType)
+
+	image, err := mr.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "<avatar-1@man>", image.Header.Get("Content-ID"))
+	encoded, _ := io.ReadAll(image)
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	require.NoError(t, err)
+	assert.Equal(t, avatar, decoded)
+
+	_, err = mr.NextPart()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,247 @@
+package man
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/userstatus"
+)
+
+type FilterDecision int
+
+const (
+	// the filter has no opinion on the post, the next filter is applied
+	FilterPass FilterDecision = iota
+	// the post is notified, next filters are not applied
+	FilterKeep
+	// the post is not notified
+	FilterDrop
+	// the post is not notified, but it is included in one of the counters
+	FilterCount
+)
+
+func (d FilterDecision) String() string {
+	switch d {
+	case FilterPass:
+		return "pass"
+	case FilterKeep:
+		return "keep"
+	case FilterDrop:
+		return "drop"
+	case FilterCount:
+		return "count"
+	}
+	return "unknown"
+}
+
+// counters shown to the user for posts that are not notified
+type FilterCounter int
+
+const (
+	NoCounter FilterCounter = iota
+	RepliesInNotFollowedThreadsCounter
+	NotifiedByMMCounter
+	PreviouslyNotifiedCounter
+)
+
+type FilterResult struct {
+	Decision FilterDecision
+	Counter  FilterCounter
+	Reason   string
+}
+
+func pass() FilterResult {
+	return FilterResult{Decision: FilterPass}
+}
+
+func keep(reason string, a ...any) FilterResult {
+	return FilterResult{Decision: FilterKeep, Reason: fmt.Sprintf(reason, a...)}
+}
+
+func drop(reason string, a ...any) FilterResult {
+	return FilterResult{Decision: FilterDrop, Reason: fmt.Sprintf(reason, a...)}
+}
+
+// returns a FilterCount result if the counter is enabled, a FilterDrop result otherwise
+func count(enabled bool, counter FilterCounter, reason string, a ...any) FilterResult {
+	if !enabled {
+		return drop(reason, a...)
+	}
+	return FilterResult{Decision: FilterCount, Counter: counter, Reason: fmt.Sprintf(reason, a...)}
+}
+
+// everything a filter needs to know to take a decision on a post
+type FilterContext struct {
+	Post                  *model.Post
+	Conversation          *model.UnreadConversation
+	User                  *model.User
+	ChannelMissedActivity *model.ChannelMissedActivity
+	LastNotifiedTimestamp time.Time
+}
+
+// A Filter decides if a post has to be notified to a user
+type Filter interface {
+	Name() string
+	Apply(ctx *FilterContext) FilterResult
+}
+
+// An ordered list of filters. Filters are applied in order until one of them
+// returns a decision different from FilterPass. If all filters pass, the post
+// is notified
+type FilterChain struct {
+	filters  []Filter
+	disabled map[string]bool
+}
+
+func NewFilterChain() *FilterChain {
+	return &FilterChain{
+		filters:  []Filter{},
+		disabled: map[string]bool{},
+	}
+}
+
+// builds the chain with the default filters of the plugin
+func NewDefaultFilterChain(userStatuses *userstatus.UserStatusTracker, mmSettings *MMNotificationSettings) *FilterChain {
+	chain := NewFilterChain()
+	chain.Register(&authorFilter{})
+	chain.Register(&systemMessagesFilter{})
+	chain.Register(&botsFilter{})
+	chain.Register(&keywordsFilter{})
+	chain.Register(&notFollowedThreadsFilter{})
+	chain.Register(&notifiedByMMFilter{userStatuses: userStatuses, settings: mmSettings})
+	chain.Register(&previouslyNotifiedFilter{})
+	return chain
+}
+
+// appends the filter at the end of the chain
+func (c *FilterChain) Register(filter Filter) {
+	c.filters = append(c.filters, filter)
+}
+
+// adds the filter to the chain just before the filter with the given name
+func (c *FilterChain) RegisterBefore(name string, filter Filter) error {
+	for i, f := range c.filters {
+		if f.Name() == name {
+			c.filters = append(c.filters[:i], append([]Filter{filter}, c.filters[i:]...)...)
+			return nil
+		}
+	}
+	return errors.Errorf("filter '%s' not found", name)
+}
+
+// disables the filters with the given names. Unknown names are ignored
+func (c *FilterChain) Disable(names ...string) {
+	for _, n := range names {
+		c.disabled[n] = true
+	}
+}
+
+// returns the names of the enabled filters, in order
+func (c *FilterChain) Names() []string {
+	res := []string{}
+	for _, f := range c.filters {
+		if !c.disabled[f.Name()] {
+			res = append(res, f.Name())
+		}
+	}
+	return res
+}
+
+// applies the filters to the post and returns the decision and the name of
+// the filter that took it (empty if no filter took a decision)
+func (c *FilterChain) Apply(ctx *FilterContext) (FilterResult, string) {
+	for _, f := range c.filters {
+		if c.disabled[f.Name()] {
+			continue
+		}
+		res := f.Apply(ctx)
+		if res.Decision != FilterPass {
+			return res, f.Name()
+		}
+	}
+	return keep("no filter excluded the post"), ""
+}
+
+type authorFilter struct{}
+
+func (f *authorFilter) Name() string { return "author" }
+
+func (f *authorFilter) Apply(ctx *FilterContext) FilterResult {
+	if ctx.Post.AuthorID == ctx.User.ID {
+		return drop("the user is the author")
+	}
+	return pass()
+}
+
+type systemMessagesFilter struct{}
+
+func (f *systemMessagesFilter) Name() string { return "system-messages" }
+
+func (f *systemMessagesFilter) Apply(ctx *FilterContext) FilterResult {
+	if ctx.Post.IsSystemMessage && !ctx.User.MANPreferences.IncludeSystemMessages {
+		return drop("it is a system message")
+	}
+	return pass()
+}
+
+type botsFilter struct{}
+
+func (f *botsFilter) Name() string { return "bots" }
+
+func (f *botsFilter) Apply(ctx *FilterContext) FilterResult {
+	if ctx.Post.FromBot && !ctx.User.MANPreferences.IncludeMessagesFromBots {
+		return drop("it is a message from a bot")
+	}
+	return pass()
+}
+
+// notifies posts that contain one of the user's keywords, even in not
+// followed threads. Posts older than the last notified timestamp are left to
+// the next filters, so they are not notified again
+type keywordsFilter struct{}
+
+func (f *keywordsFilter) Name() string { return "keywords" }
+
+func (f *keywordsFilter) Apply(ctx *FilterContext) FilterResult {
+	if len(ctx.User.MANPreferences.Keywords) == 0 || !ctx.Post.CreatedAt.After(ctx.LastNotifiedTimestamp) {
+		return pass()
+	}
+
+	matched := model.MatchKeywords(ctx.Post.Message, ctx.User.MANPreferences.Keywords)
+	if len(matched) > 0 {
+		ctx.Conversation.SetMatchedKeywords(ctx.Post, matched)
+		return keep("it contains the keywords %s", strings.Join(matched, ", "))
+	}
+	return pass()
+}
+
+type notFollowedThreadsFilter struct{}
+
+func (f *notFollowedThreadsFilter) Name() string { return "not-followed-threads" }
+
+func (f *notFollowedThreadsFilter) Apply(ctx *FilterContext) FilterResult {
+	prefs := ctx.User.MANPreferences
+	// channels always included by the administrators are notified in full
+	if ctx.ChannelMissedActivity.Policy != nil && ctx.ChannelMissedActivity.Policy.Mode == model.PolicyAlways {
+		return pass()
+	}
+	if !ctx.Post.IsRoot() && !ctx.Conversation.Following && !prefs.NotifyRepliesInNotFollowedThreads {
+		return count(prefs.IncludeCountOfRepliesInNotFollowedThreads, RepliesInNotFollowedThreadsCounter, "it is a reply in a not followed thread")
+	}
+	return pass()
+}
+
+type previouslyNotifiedFilter struct{}
+
+func (f *previouslyNotifiedFilter) Name() string { return "previously-notified" }
+
+func (f *previouslyNotifiedFilter) Apply(ctx *FilterContext) FilterResult {
+	if !ctx.Post.CreatedAt.After(ctx.LastNotifiedTimestamp) {
+		return count(ctx.User.MANPreferences.IncludeCountPreviouslyNotified, PreviouslyNotifiedCounter, "it is older than the last notified timestamp (so, it has been already notified)")
+	}
+	return pass()
+}
@@ -0,0 +1,105 @@
+package man
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/userstatus"
+)
+
+type keepBotsFilter struct{}
+
+func (f *keepBotsFilter) Name() string { return "keep-bots" }
+
+func (f *keepBotsFilter) Apply(ctx *FilterContext) FilterResult {
+	if ctx.Post.FromBot {
+		return keep("bot messages are always notified")
+	}
+	return pass()
+}
+
+func getTestingFilterContext(post *model.Post) *FilterContext {
+	user := &model.User{ID: "user1", Username: "user1", MANPreferences: model.MANUserPreferences{
+		IncludeCountOfRepliesInNotFollowedThreads: true,
+		IncludeCountPreviouslyNotified:            false,
+	}}
+	channel := &model.Channel{ID: "channel1", Type: "O"}
+	rootPost := &model.Post{ID: "root", AuthorID: "user2", CreatedAt: time.UnixMilli(1000)}
+
+	return &FilterContext{
+		Post:                  post,
+		Conversation:          model.NewUnreadConversation(rootPost, false, true),
+		User:                  user,
+		ChannelMissedActivity: model.NewChannelMissedActivity(channel, user),
+		LastNotifiedTimestamp: time.UnixMilli(2000),
+	}
+}
+
+func TestDefaultFilterChain(t *testing.T) {
+	chain := NewDefaultFilterChain(userstatus.NewUserStatusesTracker(), &MMNotificationSettings{SendEmailNotifications: true, NotifiedBy: []string{MMEmailNotification}})
+
+	res, name := chain.Apply(getTestingFilterContext(&model.Post{ID: "p1", AuthorID: "user1", CreatedAt: time.UnixMilli(3000)}))
+	assert.Equal(t, FilterDrop, res.Decision)
+	assert.Equal(t, "author", name)
+
+	res, name = chain.Apply(getTestingFilterContext(&model.Post{ID: "p2", AuthorID: "user2", RootID: "root", CreatedAt: time.UnixMilli(3000)}))
+	assert.Equal(t, FilterCount, res.Decision)
+	assert.Equal(t, RepliesInNotFollowedThreadsCounter, res.Counter)
+	assert.Equal(t, "not-followed-threads", name)
+
+	// the counter of previously notified messages is disabled in the user preferences
+	res, name = chain.Apply(getTestingFilterContext(&model.Post{ID: "p3", AuthorID: "user2", CreatedAt: time.UnixMilli(1500)}))
+	assert.Equal(t, FilterDrop, res.Decision)
+	assert.Equal(t, "previously-notified", name)
+
+	res, name = chain.Apply(getTestingFilterContext(&model.Post{ID: "p4", AuthorID: "user2", CreatedAt: time.UnixMilli(3000)}))
+	assert.Equal(t, FilterKeep, res.Decision)
+	assert.Equal(t, "", name)
+
+	// replies in not followed threads of channels always included by a policy are notified
+	ctx := getTestingFilterContext(&model.Post{ID: "p5", AuthorID: "user2", RootID: "root", CreatedAt: time.UnixMilli(3000)})
+	ctx.ChannelMissedActivity.Policy = &model.ChannelPolicy{Mode: model.PolicyAlways, Channel: "channel1"}
+	res, _ = chain.Apply(ctx)
+	assert.Equal(t, FilterKeep, res.Decision)
+}
+
+func TestFilterChainCustomization(t *testing.T) {
+	chain := NewDefaultFilterChain(userstatus.NewUserStatusesTracker(), &MMNotificationSettings{SendEmailNotifications: true, NotifiedBy: []string{MMEmailNotification}})
+	assert.Nil(t, chain.RegisterBefore("bots", &keepBotsFilter{}))
+	assert.NotNil(t, chain.RegisterBefore("unknown", &keepBotsFilter{}))
+	chain.Disable("author")
+
+	assert.Equal(t, []string{"system-messages", "keep-bots", "bots", "keywords", "not-followed-threads", "notified-by-mattermost", "previously-notified"}, chain.Names())
+
+	res, name := chain.Apply(getTestingFilterContext(&model.Post{ID: "p1", AuthorID: "user1", FromBot: true, CreatedAt: time.UnixMilli(1500)}))
+	assert.Equal(t, FilterKeep, res.Decision)
+	assert.Equal(t, "keep-bots", name)
+}
+
+func TestSimulateMMNotifications(t *testing.T) {
+	statuses := userstatus.NewUserStatusesTracker()
+	settings := &MMNotificationSettings{SendEmailNotifications: true, SendPushNotifications: true}
+
+	ctx := getTestingFilterContext(&model.Post{ID: "p1", AuthorID: "user2", CreatedAt: time.UnixMilli(3000)})
+	ctx.User.NotifyProps = map[string]string{"email": "true", "push": "mention", "push_status": "away", "desktop": "all"}
+
+	// the status of the user is unknown, so the user is considered not online
+	sent := simulateMMNotifications(ctx, settings, statuses, true)
+	assert.Equal(t, []string{MMEmailNotification, MMPushNotification}, sent.sentTypes())
+
+	sent = simulateMMNotifications(ctx, settings, statuses, false)
+	assert.Equal(t, []string{}, sent.sentTypes())
+
+	// emails disabled for the channel
+	ctx.ChannelMissedActivity.ChannelNotifyProps = map[string]string{"email": "false", "push": "default"}
+	sent = simulateMMNotifications(ctx, settings, statuses, true)
+	assert.Equal(t, []string{MMPushNotification}, sent.sentTypes())
+
+	// emails disabled on the server
+	ctx.ChannelMissedActivity.ChannelNotifyProps = map[string]string{}
+	sent = simulateMMNotifications(ctx, &MMNotificationSettings{SendPushNotifications: true}, statuses, true)
+	assert.Equal(t, []string{MMPushNotification}, sent.sentTypes())
+}
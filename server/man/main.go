@@ -2,15 +2,31 @@ package man
 
 import (
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/backend"
-	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/userstatus"
 )
 
-func RunMAN(backend *backend.MattermostBackend, userStatuses *userstatus.UserStatusTracker, options *MissedActivityOptions) ([]*model.TeamMissedActivity, error) {
+func RunMAN(backend *backend.MattermostBackend, userStatuses *userstatus.UserStatusTracker, options *MissedActivityOptions) (*RunResult, error) {
+	mmSettings := &MMNotificationSettings{
+		SendEmailNotifications: backend.IsSendEmailNotificationsEnabled(),
+		EnableEmailBatching:    backend.IsEmailBatchingEnabled(),
+		SendPushNotifications:  backend.IsSendPushNotificationsEnabled(),
+		NotifiedBy:             options.NotifiedByMMTypes,
+	}
+
+	filters := NewDefaultFilterChain(userStatuses, mmSettings)
+	filters.Disable(options.DisabledFilters...)
+
+	policies, errP := backend.GetChannelPolicies()
+	if errP != nil {
+		return nil, errP
+	}
+
 	svc := &MissedActivityNotifier{
 		backend:      backend,
 		UserStatuses: userStatuses,
 		options:      options,
+		filters:      filters,
+		policies:     policies,
 	}
 
 	return svc.Run()
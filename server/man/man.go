@@ -13,89 +13,255 @@ import (
 )
 
 type MissedActivityOptions struct {
-	LowerBound            time.Time
+	LowerBound time.Time
+	// used for users that have never been notified in a team
 	LastNotifiedTimestamp time.Time
 	UpperBound            time.Time
+	// if true, LastNotifiedTimestamp is used for all users instead of their
+	// own last notified timestamps (e.g., to rerun a past run)
+	IgnoreUsersLastNotifiedTimestamps bool
+	// time of the run, used to check users' delivery schedules
+	RunTime time.Time
+	// if true, all users are processed regardless of their delivery schedules
+	IgnoreSchedules bool
+	// names of the filters of the default chain that are not applied
+	DisabledFilters []string
+	// types of Mattermost notifications (email, push, desktop) after which
+	// a message is considered already notified
+	NotifiedByMMTypes []string
+	// maximum number of users (or channels) processed at the same time
+	Concurrency int
+	// if not empty, only these users are processed (e.g., to show the
+	// current missed activity of a user)
+	UserIDs []string
+}
+
+func (o *MissedActivityOptions) includesUser(userID string) bool {
+	if len(o.UserIDs) == 0 {
+		return true
+	}
+	for _, id := range o.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
 }
 
 type MissedActivityNotifier struct {
 	backend      *backend.MattermostBackend
 	UserStatuses *userstatus.UserStatusTracker
 	options      *MissedActivityOptions
+	filters      *FilterChain
+	policies     model.ChannelPolicies
 }
 
 func (man *MissedActivityNotifier) logDebug(message string, a ...any) {
 	man.backend.LogDebug(fmt.Sprintf(message, a...))
 }
 
-func (man *MissedActivityNotifier) ProcessMessageValidForNotification(post *model.Post, conv *model.UnreadConversation, user *model.User, cma *model.ChannelMissedActivity) bool {
-	if post.AuthorID == user.ID {
-		cma.AppendLog("Removing post \"%s\" because the user is the author", post.Message)
-		return false
+// returns the timestamp up to which the missed activity of the user in the team has been notified
+func (man *MissedActivityNotifier) getLastNotifiedTimestamp(user *model.User, team *model.Team) (time.Time, error) {
+	if man.options.IgnoreUsersLastNotifiedTimestamps {
+		return man.options.LastNotifiedTimestamp, nil
 	}
 
-	if post.IsSystemMessage && !user.MANPreferences.IncludeSystemMessages {
-		cma.AppendLog("Removing post \"%s\" because it is a system message", post.Message)
-		return false
+	lastNotified, found, err := man.backend.GetUserLastNotifiedTimestamp(user.ID, team.ID)
+	if err != nil {
+		return time.Time{}, err
 	}
 
-	if post.FromBot && !user.MANPreferences.IncludeMessagesFromBots {
-		cma.AppendLog("Removing post \"%s\" because it is a message from a bot", post.Message)
-		return false
+	if !found {
+		return man.options.LastNotifiedTimestamp, nil
 	}
 
-	if !post.IsRoot() && !conv.Following && !user.MANPreferences.NotifyRepliesInNotFollowedThreads {
-		if user.MANPreferences.IncludeCountOfRepliesInNotFollowedThreads {
-			cma.RepliesInNotFollowingConvs++
-		}
-		cma.AppendLog("Removing post \"%s\" because it is a reply in a not followed thread", post.Message)
-		return false
+	return lastNotified, nil
+}
+
+// returns true if, according to the user's schedule, the user has to be
+// processed in this run. A user is due if at least one of the delivery times
+// of the schedule falls between the last time the user has been processed and now
+func (man *MissedActivityNotifier) isUserDue(user *model.User) bool {
+	if man.options.IgnoreSchedules {
+		return true
 	}
 
-	if (model.MessageContainsMentions(post.Message, user.Username) || cma.Channel.IsDirect() || cma.Channel.IsGroup() || conv.Following) && man.UserStatuses.GetStatusForUserAtTime(user.ID, post.CreatedAt) != userstatus.Online {
-		if user.MANPreferences.InlcudeCountOfMessagesNotifiedByMM {
-			cma.NotifiedByMMMessages++
-		}
-		cma.AppendLog("Removing post \"%s\" (created at: %d) because the user should have been already notified", post.Message, post.CreatedAt.UnixMilli())
-		return false
+	schedule, errP := model.ParseSchedule(user.MANPreferences.Schedule)
+	if errP != nil {
+		man.backend.LogWarn("Invalid schedule '%s' for user %s, ignoring it: %s", user.MANPreferences.Schedule, user.Username, errP)
+		return true
 	}
 
-	if !post.CreatedAt.After(man.options.LastNotifiedTimestamp) {
-		cma.AppendLog("Removing post \"%s\" because it is older than the last notified timestamp (so, it has been already notified)", post.Message)
-		if user.MANPreferences.IncludeCountPreviouslyNotified {
+	if schedule.IsAlways() {
+		return true
+	}
+
+	lastProcessed, found, errT := man.backend.GetUserLastProcessedTimestamp(user.ID)
+	if errT != nil {
+		man.backend.LogError("Error getting last processed timestamp for user %s: %s", user.Username, errT)
+		return true
+	}
+
+	// users never processed before use the time of the previous run
+	if !found {
+		lastProcessed = man.options.LastNotifiedTimestamp
+	}
+
+	return schedule.HasDeliveryTimeBetween(lastProcessed, man.options.RunTime, user.Location())
+}
+
+// returns true (and the reason) if the notification to the user has to be
+// deferred because the user paused the notifications or it is inside the
+// user's quiet hours. Deferred users are not processed, so the missed activity
+// will be notified in the next run in which they are not deferred
+func (man *MissedActivityNotifier) isUserDeferred(user *model.User) (bool, string) {
+	if man.options.IgnoreSchedules {
+		return false, ""
+	}
+
+	if user.MANPreferences.IsPausedAt(man.options.RunTime) {
+		return true, fmt.Sprintf("notifications paused until %s", time.UnixMilli(user.MANPreferences.PausedUntil).Format(time.RFC822))
+	}
+
+	quietHours, errQ := model.ParseQuietHours(user.MANPreferences.QuietHours)
+	if errQ != nil {
+		man.backend.LogWarn("Invalid quiet hours '%s' for user %s, ignoring them: %s", user.MANPreferences.QuietHours, user.Username, errQ)
+		return false, ""
+	}
+
+	if quietHours != nil && quietHours.Contains(man.options.RunTime, user.Location()) {
+		return true, fmt.Sprintf("inside quiet hours %s", user.MANPreferences.QuietHours)
+	}
+
+	return false, ""
+}
+
+// applies the filter chain to the post and returns true if the post has to be notified.
+// The decision is recorded in the channel missed activity and, if the post is
+// not notified, the corresponding counter is updated
+func (man *MissedActivityNotifier) ProcessMessageValidForNotification(post *model.Post, conv *model.UnreadConversation, user *model.User, cma *model.ChannelMissedActivity, lastNotified time.Time) bool {
+	res, filterName := man.filters.Apply(&FilterContext{
+		Post:                  post,
+		Conversation:          conv,
+		User:                  user,
+		ChannelMissedActivity: cma,
+		LastNotifiedTimestamp: lastNotified,
+	})
+
+	cma.AppendDecision(model.PostDecision{
+		PostID:   post.ID,
+		Message:  post.Message,
+		Filter:   filterName,
+		Decision: res.Decision.String(),
+		Reason:   res.Reason,
+	})
+
+	if res.Decision == FilterCount {
+		switch res.Counter {
+		case RepliesInNotFollowedThreadsCounter:
+			cma.RepliesInNotFollowingConvs++
+		case NotifiedByMMCounter:
+			cma.NotifiedByMMMessages++
+		case PreviouslyNotifiedCounter:
 			cma.PreviouslyNotified++
 		}
-		return false
 	}
 
-	return true
+	return res.Decision == FilterKeep
 }
 
-func (man *MissedActivityNotifier) GetChannelMissedActivity(channelMembership *model.ChannelMembership) (*model.ChannelMissedActivity, error) {
-	// 1. Get all the posts in the channel that are unread for the user
-	//  (up to the run upper bound)
+// returns true if the reply has not been read by the user. With Collapsed Reply
+// Threads, replies are read in the thread, so the thread read state is used if
+// the user is a member of the thread
+func isReplyUnread(post *model.Post, channelMembership *model.ChannelMembership, threads map[string]*model.ThreadMembership) bool {
+	if tm, ok := threads[post.RootID]; ok {
+		return post.CreatedAt.After(tm.LastViewed)
+	}
+	return post.CreatedAt.After(channelMembership.LastReadPost)
+}
+
+// a channel membership of a user together with the data needed to compute
+// the missed activity of the user in the channel
+type memberActivity struct {
+	membership *model.ChannelMembership
+	// all the thread memberships of the user in the channel
+	threads map[string]*model.ThreadMembership
+	// thread memberships used to know if replies have been read (empty
+	// if the user does not use Collapsed Reply Threads)
+	readThreads map[string]*model.ThreadMembership
+	// posts created after this time can be unread for the user
+	lowerBound time.Time
+}
 
-	lowerBound := channelMembership.LastReadPost.UnixMilli()
-	if man.options.LowerBound.UnixMilli() > lowerBound {
-		lowerBound = man.options.LowerBound.UnixMilli()
+func (man *MissedActivityNotifier) newMemberActivity(channelMembership *model.ChannelMembership) (*memberActivity, error) {
+	threads, errT := man.backend.GetThreadMemberships(channelMembership.Channel.ID, channelMembership.User.ID)
+	if errT != nil {
+		return nil, errors.Wrap(errT, "Error getting thread memberships")
 	}
 
-	posts, err := man.backend.GetChannelPosts(
-		channelMembership.Channel.ID,
-		lowerBound,
-		man.options.UpperBound.UnixMilli())
+	ma := &memberActivity{
+		membership:  channelMembership,
+		threads:     threads,
+		readThreads: map[string]*model.ThreadMembership{},
+		lowerBound:  channelMembership.LastReadPost,
+	}
 
-	if err != nil {
-		return nil, errors.Wrap(err, "Error getting channel posts")
+	// with Collapsed Reply Threads, posts have to be considered from the
+	// oldest unread thread, that can be older than the last time the user
+	// viewed the channel
+	if channelMembership.User.CollapsedThreads {
+		ma.readThreads = threads
+		for _, tm := range threads {
+			if tm.IsUnread() && tm.LastViewed.Before(ma.lowerBound) {
+				ma.lowerBound = tm.LastViewed
+			}
+		}
 	}
 
-	man.backend.LogDebug("Retrieved %d posts for user '%s' in channel '%s' (from %d)", len(posts), channelMembership.User.Username, channelMembership.Channel.GetChannelName(channelMembership.User), lowerBound)
+	if man.options.LowerBound.After(ma.lowerBound) {
+		ma.lowerBound = man.options.LowerBound
+	}
+
+	return ma, nil
+}
+
+// returns the posts created after the lower bound and the root posts of their
+// threads. Posts are expected (and returned) in creation order
+func slicePosts(posts []*model.Post, lowerBound time.Time) []*model.Post {
+	rootIDs := map[string]bool{}
+	for _, post := range posts {
+		if !post.IsRoot() && post.CreatedAt.After(lowerBound) {
+			rootIDs[post.RootID] = true
+		}
+	}
+
+	res := []*model.Post{}
+	for _, post := range posts {
+		if post.CreatedAt.After(lowerBound) || (post.IsRoot() && rootIDs[post.ID]) {
+			res = append(res, post)
+		}
+	}
+	return res
+}
+
+// computes the missed activity of the user in the channel from the posts of
+// the channel loaded in this run
+func (man *MissedActivityNotifier) GetChannelMissedActivity(ma *memberActivity, channelPosts []*model.Post, lastNotified time.Time) *model.ChannelMissedActivity {
+	channelMembership := ma.membership
+
+	// 1. Get all the posts in the channel that are unread for the user
+	//  (up to the run upper bound)
+	posts := slicePosts(channelPosts, ma.lowerBound)
+
+	man.backend.LogDebug("Selected %d posts for user '%s' in channel '%s' (from %d)", len(posts), channelMembership.User.Username, channelMembership.Channel.GetChannelName(channelMembership.User), ma.lowerBound.UnixMilli())
 
 	if len(posts) == 0 {
-		return nil, nil
+		return nil
 	}
 
 	crs := model.NewChannelMissedActivity(channelMembership.Channel, channelMembership.User)
+	crs.ChannelNotifyProps = channelMembership.NotifyProps
+	crs.Policy = man.policies.ForChannel(channelMembership.Channel)
 
 	// 2. organize posts in conversations ***
 	rootPostsMap := make(map[string]*model.UnreadConversation)
@@ -106,7 +272,7 @@ func (man *MissedActivityNotifier) GetChannelMissedActivity(channelMembership *m
 		if post.IsRoot() { // creates a new unread conversation for each root post
 			rootPostsMap[post.ID] = model.NewUnreadConversation(
 				post,
-				man.backend.IsUserFollowingPost(post.ID, channelMembership.User.ID),
+				ma.threads[post.ID] != nil && ma.threads[post.ID].Following,
 				channelMembership.LastReadPost.Before(post.CreatedAt),
 			)
 		} else { // add replies to conversations
@@ -120,7 +286,17 @@ func (man *MissedActivityNotifier) GetChannelMissedActivity(channelMembership *m
 				}
 			}
 
-			valid := man.ProcessMessageValidForNotification(post, conversation, channelMembership.User, crs)
+			if !isReplyUnread(post, channelMembership, ma.readThreads) {
+				crs.AppendDecision(model.PostDecision{
+					PostID:   post.ID,
+					Message:  post.Message,
+					Decision: FilterDrop.String(),
+					Reason:   "the user already read it",
+				})
+				continue
+			}
+
+			valid := man.ProcessMessageValidForNotification(post, conversation, channelMembership.User, crs, lastNotified)
 			if valid {
 				conversation.AppendReply(post)
 			}
@@ -129,7 +305,7 @@ func (man *MissedActivityNotifier) GetChannelMissedActivity(channelMembership *m
 
 	// 3. filter conversations
 	for _, conversation := range rootPostsMap {
-		eligible := man.ProcessMessageValidForNotification(conversation.RootPost, conversation, channelMembership.User, crs)
+		eligible := man.ProcessMessageValidForNotification(conversation.RootPost, conversation, channelMembership.User, crs, lastNotified)
 		hasReplies := len(conversation.Replies) > 0
 		isRootRead := !conversation.IsRootMessageUnread
 
@@ -143,52 +319,164 @@ func (man *MissedActivityNotifier) GetChannelMissedActivity(channelMembership *m
 		return crs.UnreadConversations[i].MostRecentMessage.Before(crs.UnreadConversations[j].MostRecentMessage)
 	})
 
-	return crs, nil
+	return crs
+}
+
+// the missed activity of a user in a team (or in direct messages) to be computed
+type userTeamActivity struct {
+	user         *model.User
+	team         *model.Team
+	lastNotified time.Time
+	members      []*memberActivity
 }
 
-func (man *MissedActivityNotifier) GetUserMissedActivity(team *model.Team, user *model.User, includeDirectMessages bool) (*model.TeamMissedActivity, error) {
-	uma := &model.TeamMissedActivity{
-		User:           user,
-		Team:           team,
-		UnreadChannels: []model.ChannelMissedActivity{},
-		Logs:           []string{},
+// collects the channel memberships of the user in the team that are not
+// muted or excluded by the user
+func (man *MissedActivityNotifier) getUserTeamActivity(team *model.Team, user *model.User, includeDirectMessages bool) (*userTeamActivity, error) {
+	lastNotified, errT := man.getLastNotifiedTimestamp(user, team)
+	if errT != nil {
+		return nil, errors.Wrap(errT, "Error getting user last notified timestamp")
 	}
 
-	man.backend.LogDebug("Getting missed activity for user '%s' in team '%s'", user.Username, team.Name)
+	uta := &userTeamActivity{
+		user:         user,
+		team:         team,
+		lastNotified: lastNotified,
+		members:      []*memberActivity{},
+	}
 
-	// 1. get channels memeberships
 	mb, err := man.backend.GetChannelMembersForUser(team.ID, user.ID, includeDirectMessages)
 	if err != nil {
 		return nil, err
 	}
 
-	uchs := []model.ChannelMissedActivity{}
-
-	// 2. for each not muted channel where the user is member, get the missed activity
-	for _, channelMembership := range mb {
-		if channelMembership.IsMuted() {
-			man.logDebug("Skipping channel '%s' for user '%s' because it has been muted", channelMembership.Channel.GetChannelName(channelMembership.User), channelMembership.User.Username)
+	for _, m := range mb {
+		// the user may have different preferences in the team. Memberships
+		// returned by the backend are copied, not modified
+		membership := *m
+		membership.User = user
+		channelMembership := &membership
+
+		// admin policies come first, then channels excluded by the user are
+		// never notified and channels included by the user are notified even
+		// if muted in Mattermost
+		status, _ := model.GetChannelStatus(man.policies, channelMembership)
+		if !model.IsChannelStatusNotified(status) {
+			man.logDebug("Skipping channel '%s' for user '%s' (%s)", channelMembership.Channel.GetChannelName(user), user.Username, status)
 			continue
 		}
 
-		crs, errUCh := man.GetChannelMissedActivity(channelMembership)
-		if errUCh != nil {
-			return nil, errors.Wrap(errUCh, "Error computing user's missed activity")
+		ma, errM := man.newMemberActivity(channelMembership)
+		if errM != nil {
+			return nil, errors.Wrap(errM, "Error computing user's missed activity")
+		}
+		uta.members = append(uta.members, ma)
+	}
+
+	return uta, nil
+}
+
+// returns the missed activity of the user in the team, using the posts loaded
+// for each channel. The returned object is empty (see TeamMissedActivity.IsEmpty())
+// if there is nothing to notify. An error is returned if the posts of one of
+// the channels could not be loaded
+func (man *MissedActivityNotifier) buildUserMissedActivity(uta *userTeamActivity, channelsPosts map[string][]*model.Post) (*model.TeamMissedActivity, error) {
+	man.backend.LogDebug("Getting missed activity for user '%s' in team '%s' (last notified: %d)", uta.user.Username, uta.team.Name, uta.lastNotified.UnixMilli())
+
+	uchs := []model.ChannelMissedActivity{}
+	for _, ma := range uta.members {
+		posts, ok := channelsPosts[ma.membership.Channel.ID]
+		if !ok {
+			return nil, errors.Errorf("posts of channel '%s' not loaded", ma.membership.Channel.GetChannelName(uta.user))
 		}
 
+		crs := man.GetChannelMissedActivity(ma, posts, uta.lastNotified)
 		if crs != nil {
 			uchs = append(uchs, *crs)
 		}
 	}
 
-	if len(uchs) == 0 {
-		return nil, nil
+	return &model.TeamMissedActivity{
+		User:                  uta.user,
+		Team:                  uta.team,
+		UnreadChannels:        uchs,
+		Logs:                  []string{},
+		LastNotifiedTimestamp: uta.lastNotified,
+	}, nil
+}
+
+// returns a copy of the user with the preferences of the user in the team
+func userInTeam(user *model.User, team *model.Team) *model.User {
+	if _, ok := user.MANPreferences.Teams[team.ID]; !ok {
+		return user
+	}
+	res := *user
+	res.MANPreferences = user.MANPreferences.ForTeam(team.ID)
+	return &res
+}
+
+// returns the teams (and direct messages) to process for the user
+func (man *MissedActivityNotifier) getUserTeamsActivity(user *model.User) ([]*userTeamActivity, error) {
+	teams, err3 := man.backend.GetTeamsForUser(user.ID)
+	if err3 != nil {
+		return nil, errors.Wrap(err3, "Error getting team list, cannot continue")
+	}
+
+	// only one team. We include in this team also the direct messages
+	if len(teams) == 1 {
+		if !user.MANPreferences.IsTeamEnabled(teams[0].ID) {
+			man.logDebug("Skipping team '%s' for user '%s' because it has been disabled", teams[0].Name, user.Username)
+			return []*userTeamActivity{}, nil
+		}
+		uta, err := man.getUserTeamActivity(teams[0], userInTeam(user, teams[0]), true)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("error getting user missed activity in team %s (including direct messages), cannot continue", teams[0].Name))
+		}
+		return []*userTeamActivity{uta}, nil
 	}
-	uma.UnreadChannels = uchs
-	return uma, nil
+
+	// append a fake team to handle direct messages. Direct Messages does not belong
+	// to a particular Team, so to manage them uniformely we use this special team
+	teams = append(teams, model.DirectMessagesFakeTeam)
+
+	res := []*userTeamActivity{}
+	for _, team := range teams {
+		if !user.MANPreferences.IsTeamEnabled(team.ID) {
+			man.logDebug("Skipping team '%s' for user '%s' because it has been disabled", team.Name, user.Username)
+			continue
+		}
+		uta, err := man.getUserTeamActivity(team, userInTeam(user, team), false)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("error getting user missed activity in team %s, cannot continue", team.Name))
+		}
+		res = append(res, uta)
+	}
+	return res, nil
+}
+
+// result of a run
+type RunResult struct {
+	// missed activity of the processed users, one object for each user and
+	// team (including the ones with nothing to notify)
+	Activities []*model.TeamMissedActivity
+	// users whose missed activity could not be computed, in at least one team
+	Errors []*model.UserRunError
+	// users processed in this run, also the ones without missed activity
+	ProcessedUsers []*model.User
+	// users not processed in this run because not due according to their
+	// schedule or deferred. Their missed activity is notified in a next run
+	SkippedUsers []*model.User
 }
 
-func (man *MissedActivityNotifier) Run() ([]*model.TeamMissedActivity, error) {
+// returns the missed activity of all notifiable users that are due in this run,
+// one object for each user and team (including the ones with nothing to notify).
+// The computation is channel-centric: the posts of each channel are loaded
+// once for all its members, from the oldest post that can be unread for one
+// of them, and then selected in memory for each member.
+// Errors affecting a single user do not stop the run: they are returned
+// together with the missed activity of the other users (and of the teams of
+// the user that have been computed successfully)
+func (man *MissedActivityNotifier) Run() (*RunResult, error) {
 	// 1. get all users that are eligible to receive notifications
 	//    (exclude system users and users that deactivated the plugin)
 	users, err2 := man.backend.GetNotifiableUsers()
@@ -196,42 +484,164 @@ func (man *MissedActivityNotifier) Run() ([]*model.TeamMissedActivity, error) {
 		return nil, errors.Wrap(err2, "Error getting user list, cannot continue")
 	}
 
-	res := []*model.TeamMissedActivity{}
-
+	dueUsers := []*model.User{}
+	skippedUsers := []*model.User{}
 	for _, user := range users {
-		teams, err3 := man.backend.GetTeamsForUser(user.ID)
-		if err3 != nil {
-			return nil, errors.Wrap(err3, "Error getting team list, cannot continue")
+		if !man.options.includesUser(user.ID) {
+			continue
 		}
 
-		// only one team. We include in this team also the direct messages
-		if len(teams) == 1 {
-			uma, err := man.GetUserMissedActivity(teams[0], user, true)
+		if deferred, reason := man.isUserDeferred(user); deferred {
+			man.logDebug("Deferring notifications for user '%s': %s", user.Username, reason)
+			skippedUsers = append(skippedUsers, user)
+			continue
+		}
 
-			if err != nil {
-				return nil, errors.Wrap(err, fmt.Sprintf("error getting user missed activity in team %s (including direct messages), cannot continue", teams[0].Name))
-			}
+		if !man.isUserDue(user) {
+			man.logDebug("Skipping user '%s' because not due according to the schedule '%s'", user.Username, user.MANPreferences.Schedule)
+			skippedUsers = append(skippedUsers, user)
+			continue
+		}
+
+		dueUsers = append(dueUsers, user)
+	}
+
+	// 2. collect the channel memberships of the users to process
+	activities, runErrors := collectUsersActivities(dueUsers, man.options.Concurrency, man.getUserTeamsActivity)
+	for _, re := range runErrors {
+		man.backend.LogError("Error getting missed activity for user '%s': %s", re.User.Username, re.Err)
+	}
 
-			if uma != nil {
-				res = append(res, uma)
+	channelsLowerBound := map[string]time.Time{}
+	for _, uta := range activities {
+		for _, ma := range uta.members {
+			channelID := ma.membership.Channel.ID
+			if lb, ok := channelsLowerBound[channelID]; !ok || ma.lowerBound.Before(lb) {
+				channelsLowerBound[channelID] = ma.lowerBound
 			}
-		} else {
-			// append a fake team to handle direct messages. Direct Messages does not belong
-			// to a particular Team, so to manage them uniformely we use this special team
-			teams = append(teams, model.DirectMessagesFakeTeam)
+		}
+	}
 
-			for _, team := range teams {
-				uma, err := man.GetUserMissedActivity(team, user, false)
+	// 3. load the posts of each channel once. Channels whose posts cannot be
+	//    loaded are left out of the map
+	channelIDs := []string{}
+	for channelID := range channelsLowerBound {
+		channelIDs = append(channelIDs, channelID)
+	}
+	sort.Strings(channelIDs)
 
-				if err != nil {
-					return nil, errors.Wrap(err, fmt.Sprintf("error getting user missed activity in team %s, cannot continue", teams[0].Name))
-				}
+	postsByChannel := make([][]*model.Post, len(channelIDs))
+	postsErrors := make([]error, len(channelIDs))
 
-				if uma != nil {
-					res = append(res, uma)
-				}
-			}
+	forEachConcurrently(len(channelIDs), man.options.Concurrency, func(i int) {
+		lowerBound := channelsLowerBound[channelIDs[i]]
+		postsByChannel[i], postsErrors[i] = man.backend.GetChannelPosts(channelIDs[i], lowerBound.UnixMilli(), man.options.UpperBound.UnixMilli())
+		man.backend.LogDebug("Retrieved %d posts in channel %s (from %d)", len(postsByChannel[i]), channelIDs[i], lowerBound.UnixMilli())
+	})
+
+	channelsPosts := map[string][]*model.Post{}
+	for i, channelID := range channelIDs {
+		if postsErrors[i] != nil {
+			man.backend.LogError("Error getting posts of channel %s: %s", channelID, postsErrors[i])
+			continue
 		}
+		channelsPosts[channelID] = postsByChannel[i]
 	}
-	return res, nil
+
+	// 4. compute the missed activity of each user in each team
+	res, teamsErrors := buildTeamsActivity(activities, man.options.Concurrency, func(uta *userTeamActivity) (*model.TeamMissedActivity, error) {
+		return man.buildUserMissedActivity(uta, channelsPosts)
+	})
+	for _, re := range teamsErrors {
+		man.backend.LogError("Error getting missed activity for user '%s': %s", re.User.Username, re.Err)
+	}
+	runErrors = append(runErrors, teamsErrors...)
+
+	// 5. merge the teams of the users that want a single digest
+	return &RunResult{
+		Activities:     mergeTeams(dueUsers, res),
+		Errors:         runErrors,
+		ProcessedUsers: dueUsers,
+		SkippedUsers:   skippedUsers,
+	}, nil
+}
+
+// returns the teams activity of the users, computed concurrently with get.
+// Users for which get fails are returned as errors and do not affect the
+// activity of the other users
+func collectUsersActivities(users []*model.User, workers int, get func(user *model.User) ([]*userTeamActivity, error)) ([]*userTeamActivity, []*model.UserRunError) {
+	usersActivities := make([][]*userTeamActivity, len(users))
+	usersErrors := make([]error, len(users))
+
+	forEachConcurrently(len(users), workers, func(i int) {
+		usersActivities[i], usersErrors[i] = get(users[i])
+	})
+
+	res := []*userTeamActivity{}
+	runErrors := []*model.UserRunError{}
+	for i, utas := range usersActivities {
+		if usersErrors[i] != nil {
+			runErrors = append(runErrors, &model.UserRunError{User: users[i], Err: usersErrors[i]})
+			continue
+		}
+		res = append(res, utas...)
+	}
+	return res, runErrors
+}
+
+// returns the missed activity of each user in each team, computed
+// concurrently with build. A team that fails is returned as an error of its
+// user and does not affect the other teams
+func buildTeamsActivity(activities []*userTeamActivity, workers int, build func(uta *userTeamActivity) (*model.TeamMissedActivity, error)) ([]*model.TeamMissedActivity, []*model.UserRunError) {
+	teamsActivity := make([]*model.TeamMissedActivity, len(activities))
+	teamsErrors := make([]error, len(activities))
+
+	forEachConcurrently(len(activities), workers, func(i int) {
+		teamsActivity[i], teamsErrors[i] = build(activities[i])
+	})
+
+	res := []*model.TeamMissedActivity{}
+	runErrors := []*model.UserRunError{}
+	for i, uma := range teamsActivity {
+		if teamsErrors[i] != nil {
+			runErrors = append(runErrors, &model.UserRunError{
+				User: activities[i].user,
+				Err:  errors.Wrap(teamsErrors[i], fmt.Sprintf("error getting missed activity in team %s", activities[i].team.Name)),
+			})
+			continue
+		}
+		res = append(res, uma)
+	}
+	return res, runErrors
+}
+
+// replaces the missed activity in the teams of the users that set the
+// MergeTeams preference with a single object for all the teams
+func mergeTeams(users []*model.User, activities []*model.TeamMissedActivity) []*model.TeamMissedActivity {
+	byUser := map[string][]*model.TeamMissedActivity{}
+	for _, a := range activities {
+		byUser[a.User.ID] = append(byUser[a.User.ID], a)
+	}
+
+	merged := map[string]*model.TeamMissedActivity{}
+	for _, user := range users {
+		if user.MANPreferences.MergeTeams && len(byUser[user.ID]) > 1 {
+			merged[user.ID] = model.MergeTeamMissedActivities(user, byUser[user.ID])
+		}
+	}
+
+	res := []*model.TeamMissedActivity{}
+	for _, a := range activities {
+		m, ok := merged[a.User.ID]
+		if !ok {
+			res = append(res, a)
+			continue
+		}
+		// the merged object takes the place of the first team of the user
+		if m != nil {
+			res = append(res, m)
+			merged[a.User.ID] = nil
+		}
+	}
+	return res
 }
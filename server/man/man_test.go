@@ -0,0 +1,107 @@
+package man
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+func TestIsReplyUnread(t *testing.T) {
+	membership := &model.ChannelMembership{LastReadPost: time.UnixMilli(2000)}
+	threads := map[string]*model.ThreadMembership{
+		"root1": {PostID: "root1", LastViewed: time.UnixMilli(1000), LastReplyAt: time.UnixMilli(1500)},
+		"root2": {PostID: "root2", LastViewed: time.UnixMilli(3000), LastReplyAt: time.UnixMilli(2500)},
+	}
+
+	// unread in the thread, even if the channel has been viewed later
+	assert.True(t, isReplyUnread(&model.Post{RootID: "root1", CreatedAt: time.UnixMilli(1500)}, membership, threads))
+	// read in the thread, even if the channel has been viewed before
+	assert.False(t, isReplyUnread(&model.Post{RootID: "root2", CreatedAt: time.UnixMilli(2500)}, membership, threads))
+	// not a thread member, the channel read state is used
+	assert.True(t, isReplyUnread(&model.Post{RootID: "root3", CreatedAt: time.UnixMilli(2500)}, membership, threads))
+	assert.False(t, isReplyUnread(&model.Post{RootID: "root3", CreatedAt: time.UnixMilli(1500)}, membership, map[string]*model.ThreadMembership{}))
+}
+
+func TestSlicePosts(t *testing.T) {
+	posts := []*model.Post{
+		{ID: "root1", CreatedAt: time.UnixMilli(1000)},
+		{ID: "root2", CreatedAt: time.UnixMilli(1500)},
+		{ID: "reply1", RootID: "root1", CreatedAt: time.UnixMilli(2000)},
+		{ID: "reply2", RootID: "root2", CreatedAt: time.UnixMilli(2500)},
+		{ID: "root3", CreatedAt: time.UnixMilli(3000)},
+	}
+
+	ids := func(posts []*model.Post) []string {
+		res := []string{}
+		for _, p := range posts {
+			res = append(res, p.ID)
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{"root2", "reply2", "root3"}, ids(slicePosts(posts, time.UnixMilli(2000))))
+	assert.Equal(t, []string{"root1", "root2", "reply1", "reply2", "root3"}, ids(slicePosts(posts, time.UnixMilli(1200))))
+	assert.Equal(t, []string{}, ids(slicePosts(posts, time.UnixMilli(3000))))
+}
+
+func TestMergeTeams(t *testing.T) {
+	merging := &model.User{ID: "user1", MANPreferences: model.MANUserPreferences{MergeTeams: true}}
+	other := &model.User{ID: "user2"}
+	team1 := &model.Team{ID: "team1", Name: "Team 1"}
+	team2 := &model.Team{ID: "team2", Name: "Team 2"}
+
+	activities := []*model.TeamMissedActivity{
+		{User: merging, Team: team1, LastNotifiedTimestamp: time.UnixMilli(2000)},
+		{User: other, Team: team1},
+		{User: merging, Team: team2, LastNotifiedTimestamp: time.UnixMilli(1000)},
+		{User: merging, Team: model.DirectMessagesFakeTeam, LastNotifiedTimestamp: time.UnixMilli(3000)},
+		{User: other, Team: team2},
+	}
+
+	res := mergeTeams([]*model.User{merging, other}, activities)
+	assert.Len(t, res, 3)
+	assert.Equal(t, model.AllTeamsFakeTeam, res[0].Team)
+	assert.Equal(t, []*model.Team{team1, team2, model.DirectMessagesFakeTeam}, res[0].GetTeams())
+	assert.Equal(t, time.UnixMilli(1000), res[0].LastNotifiedTimestamp)
+	assert.Equal(t, activities[1], res[1])
+	assert.Equal(t, activities[4], res[2])
+}
+
+func TestFailingUserDoesNotAffectOthers(t *testing.T) {
+	users := []*model.User{{ID: "user1"}, {ID: "user2"}, {ID: "user3"}}
+	team1 := &model.Team{ID: "team1", Name: "Team 1"}
+	team2 := &model.Team{ID: "team2", Name: "Team 2"}
+
+	activities, runErrors := collectUsersActivities(users, 2, func(user *model.User) ([]*userTeamActivity, error) {
+		if user.ID == "user2" {
+			return nil, errors.New("cannot load teams")
+		}
+		return []*userTeamActivity{{user: user, team: team1}, {user: user, team: team2}}, nil
+	})
+	assert.Len(t, activities, 4)
+	for _, uta := range activities {
+		assert.NotEqual(t, "user2", uta.user.ID)
+	}
+	assert.Len(t, runErrors, 1)
+	assert.Equal(t, users[1], runErrors[0].User)
+
+	// the activity of a user in a team fails, the other teams of the user
+	// and the other users are still returned
+	res, teamsErrors := buildTeamsActivity(activities, 2, func(uta *userTeamActivity) (*model.TeamMissedActivity, error) {
+		if uta.user.ID == "user3" && uta.team == team2 {
+			return nil, errors.New("posts not loaded")
+		}
+		return &model.TeamMissedActivity{User: uta.user, Team: uta.team}, nil
+	})
+	assert.Len(t, res, 3)
+	for _, a := range res {
+		assert.False(t, a.User.ID == "user3" && a.Team == team2)
+	}
+	assert.Len(t, teamsErrors, 1)
+	assert.Equal(t, users[2], teamsErrors[0].User)
+	assert.Contains(t, teamsErrors[0].Err.Error(), "Team 2")
+}
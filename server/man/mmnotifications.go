@@ -0,0 +1,149 @@
+package man
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/userstatus"
+)
+
+// types of notifications sent by Mattermost
+const (
+	MMEmailNotification   = "email"
+	MMPushNotification    = "push"
+	MMDesktopNotification = "desktop"
+)
+
+// Mattermost sends batched emails every 15 minutes by default
+const defaultEmailBatchingInterval = 15 * time.Minute
+
+// server settings that affect the notifications sent by Mattermost
+type MMNotificationSettings struct {
+	SendEmailNotifications bool
+	EnableEmailBatching    bool
+	SendPushNotifications  bool
+	// types of notifications (email, push, desktop) after which a message is
+	// considered already notified by Mattermost
+	NotifiedBy []string
+}
+
+// notifications that Mattermost should have sent to a user for a post
+type mmNotifications struct {
+	Email   bool
+	Push    bool
+	Desktop bool
+}
+
+func (n mmNotifications) sentTypes() []string {
+	res := []string{}
+	if n.Email {
+		res = append(res, MMEmailNotification)
+	}
+	if n.Push {
+		res = append(res, MMPushNotification)
+	}
+	if n.Desktop {
+		res = append(res, MMDesktopNotification)
+	}
+	return res
+}
+
+// returns the notification level (all, mention, none) for the given notify
+// prop, using the channel preference if set, otherwise the user's one
+func notifyLevel(prop string, user *model.User, channelNotifyProps map[string]string) string {
+	if level, ok := channelNotifyProps[prop]; ok && level != "" && level != "default" {
+		return level
+	}
+	return user.NotifyProps[prop]
+}
+
+// simulates the logic used by Mattermost to send notifications, using the
+// notification preferences of the user and of the channel and the user
+// status when the post was created. The user's "mention level" is true if
+// the post mentions the user, it is a direct/group message or in a followed thread
+func simulateMMNotifications(ctx *FilterContext, settings *MMNotificationSettings, userStatuses *userstatus.UserStatusTracker, mentionLevel bool) mmNotifications {
+	res := mmNotifications{}
+	user := ctx.User
+	channelProps := ctx.ChannelMissedActivity.ChannelNotifyProps
+
+	// email: sent for mentions only, if the user is not online. With email
+	// batching, the user status is checked when the batch is sent
+	if settings.SendEmailNotifications && mentionLevel {
+		allowsEmails := user.NotifyProps["email"] != "false"
+		if channelEmail, ok := channelProps["email"]; ok && channelEmail != "" && channelEmail != "default" {
+			allowsEmails = channelEmail != "false"
+		}
+
+		statusTime := ctx.Post.CreatedAt
+		if settings.EnableEmailBatching {
+			interval := user.EmailInterval
+			if interval == 0 {
+				interval = defaultEmailBatchingInterval
+			}
+			statusTime = statusTime.Add(interval)
+		}
+
+		res.Email = allowsEmails && userStatuses.GetStatusForUserAtTime(user.ID, statusTime) != userstatus.Online
+	}
+
+	status := userStatuses.GetStatusForUserAtTime(user.ID, ctx.Post.CreatedAt)
+
+	// push: depends on the push level and on the status in which the user
+	// wants to receive them
+	if settings.SendPushNotifications {
+		level := notifyLevel("push", user, channelProps)
+		if level == "all" || (level == "mention" && mentionLevel) {
+			switch user.NotifyProps["push_status"] {
+			case "online":
+				res.Push = true
+			case "offline":
+				res.Push = status == userstatus.Offline || status == userstatus.Unknown
+			default: // away
+				res.Push = status != userstatus.Online
+			}
+		}
+	}
+
+	// desktop: only shown if the user is online
+	level := notifyLevel("desktop", user, channelProps)
+	if level == "all" || (level == "mention" && mentionLevel) {
+		res.Desktop = status == userstatus.Online
+	}
+
+	return res
+}
+
+// excludes posts for which Mattermost should have already sent a notification
+type notifiedByMMFilter struct {
+	userStatuses *userstatus.UserStatusTracker
+	settings     *MMNotificationSettings
+}
+
+func (f *notifiedByMMFilter) Name() string { return "notified-by-mattermost" }
+
+func (f *notifiedByMMFilter) Apply(ctx *FilterContext) FilterResult {
+	cma := ctx.ChannelMissedActivity
+	channel := cma.Channel
+
+	// Mattermost does not send emails for @here mentions
+	mentions := ctx.User.GetMentions(ctx.Post.Message)
+	mentioned := mentions.Direct || mentions.Keyword || mentions.Group || (mentions.Channel && !cma.IgnoresChannelMentions())
+	mentionLevel := mentioned || channel.IsDirect() || channel.IsGroup() || ctx.Conversation.Following
+
+	sent := simulateMMNotifications(ctx, f.settings, f.userStatuses, mentionLevel)
+
+	notifiedBy := []string{}
+	for _, t := range sent.sentTypes() {
+		for _, n := range f.settings.NotifiedBy {
+			if t == n {
+				notifiedBy = append(notifiedBy, t)
+			}
+		}
+	}
+
+	if len(notifiedBy) > 0 {
+		return count(ctx.User.MANPreferences.InlcudeCountOfMessagesNotifiedByMM, NotifiedByMMCounter, "the user should have been already notified by %s (created at: %d)", strings.Join(notifiedBy, ", "), ctx.Post.CreatedAt.UnixMilli())
+	}
+	return pass()
+}
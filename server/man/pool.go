@@ -0,0 +1,32 @@
+package man
+
+import "sync"
+
+// calls fn for each index in [0, n), running at most `workers` calls at the
+// same time. It returns when all the calls completed. Callers collect results
+// by index, so they are in the same order regardless of the workers
+func forEachConcurrently(n int, workers int, fn func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+
+	wg.Wait()
+}
@@ -0,0 +1,22 @@
+package man
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEachConcurrently(t *testing.T) {
+	res := make([]int, 100)
+	forEachConcurrently(len(res), 4, func(i int) {
+		res[i] = i * i
+	})
+	for i, v := range res {
+		assert.Equal(t, i*i, v)
+	}
+
+	// no calls and no workers
+	forEachConcurrently(0, 4, func(i int) {
+		assert.Fail(t, "should not be called")
+	})
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// actions that can be executed from the links in the digests
+const (
+	ActionDisable        = "disable"         // disable the plugin for the user
+	ActionExcludeChannel = "exclude_channel" // stop notifying the messages of a channel
+	ActionSnooze         = "snooze"          // pause the notifications for ActionSnoozeDuration
+	ActionMarkRead       = "mark_read"       // mark a channel as read
+)
+
+// links in the digests expire after this time
+const ActionTokenValidity = 30 * 24 * time.Hour
+
+// how long the notifications are paused by the snooze action
+const ActionSnoozeDuration = 7 * 24 * time.Hour
+
+func IsAction(action string) bool {
+	switch action {
+	case ActionDisable, ActionExcludeChannel, ActionSnooze, ActionMarkRead:
+		return true
+	}
+	return false
+}
+
+// an action for a user, signed and embedded in the links of the digests
+type ActionToken struct {
+	UserID    string `json:"u"`
+	Action    string `json:"a"`
+	ChannelID string `json:"c,omitempty"`
+	ExpiresAt int64  `json:"e"` // unix timestamp in seconds
+	// random id of the link. Links can be used only once
+	Nonce string `json:"n"`
+}
+
+func actionTokenSignature(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// returns the token as "<payload>.<signature>", both base64 url encoded
+func SignActionToken(key []byte, token *ActionToken) (string, error) {
+	ser, err := json.Marshal(token)
+	if err != nil {
+		return "", errors.Wrap(err, "Error serializing action token")
+	}
+	payload := base64.RawURLEncoding.EncodeToString(ser)
+	return payload + "." + actionTokenSignature(key, payload), nil
+}
+
+// verifies the signature and the expiration of the token and returns it
+func ParseActionToken(key []byte, signed string, now time.Time) (*ActionToken, error) {
+	parts := strings.Split(signed, ".")
+	if len(parts) != 2 {
+		return nil, errors.New("malformed token")
+	}
+
+	if !hmac.Equal([]byte(parts[1]), []byte(actionTokenSignature(key, parts[0]))) {
+		return nil, errors.New("invalid signature")
+	}
+
+	ser, errD := base64.RawURLEncoding.DecodeString(parts[0])
+	if errD != nil {
+		return nil, errors.Wrap(errD, "malformed token")
+	}
+
+	var token ActionToken
+	if err := json.Unmarshal(ser, &token); err != nil {
+		return nil, errors.Wrap(err, "malformed token")
+	}
+
+	if !now.Before(time.Unix(token.ExpiresAt, 0)) {
+		return nil, errors.New("token expired")
+	}
+	if token.Nonce == "" {
+		return nil, errors.New("missing nonce")
+	}
+	if token.UserID == "" || !IsAction(token.Action) {
+		return nil, errors.Errorf("invalid action '%s'", token.Action)
+	}
+	if token.ChannelID == "" && (token.Action == ActionExcludeChannel || token.Action == ActionMarkRead) {
+		return nil, errors.Errorf("missing channel for action '%s'", token.Action)
+	}
+
+	return &token, nil
+}
+
+// an action executed from a link, recorded in the audit log
+type ActionAuditEntry struct {
+	Time      int64 // unix timestamp in milliseconds
+	UserID    string
+	Username  string
+	Action    string
+	ChannelID string
+	Error     string // empty if the action succeeded
+}
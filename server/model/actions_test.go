@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActionToken(t *testing.T) {
+	key := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	token := &ActionToken{UserID: "user1", Action: ActionMarkRead, ChannelID: "channel1", ExpiresAt: now.Add(time.Hour).Unix(), Nonce: "nonce1"}
+
+	signed, err := SignActionToken(key, token)
+	assert.NoError(t, err)
+
+	parsed, err := ParseActionToken(key, signed, now)
+	assert.NoError(t, err)
+	assert.Equal(t, token, parsed)
+
+	_, err = ParseActionToken([]byte("other"), signed, now)
+	assert.Error(t, err)
+
+	_, err = ParseActionToken(key, signed, now.Add(time.Hour))
+	assert.Error(t, err)
+
+	_, err = ParseActionToken(key, "x"+signed, now)
+	assert.Error(t, err)
+
+	noChannel, _ := SignActionToken(key, &ActionToken{UserID: "user1", Action: ActionExcludeChannel, ExpiresAt: now.Add(time.Hour).Unix(), Nonce: "nonce2"})
+	_, err = ParseActionToken(key, noChannel, now)
+	assert.Error(t, err)
+
+	noNonce, _ := SignActionToken(key, &ActionToken{UserID: "user1", Action: ActionDisable, ExpiresAt: now.Add(time.Hour).Unix()})
+	_, err = ParseActionToken(key, noNonce, now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,14 @@
+package model
+
+// number of past digests kept for each user, to be viewed in the browser
+const DigestArchiveSize = 5
+
+// a digest sent to the user, as rendered for the web page
+type ArchivedDigest struct {
+	ID        string
+	TeamID    string
+	TeamName  string
+	Subject   string
+	CreatedAt int64 // unix timestamp in milliseconds
+	HTML      string
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// what triggers a mention for a user, according to the user's Mattermost
+// notification settings
+type MentionKeys struct {
+	Username        string
+	FirstName       string   // empty if mentions by first name are disabled
+	Keys            []string // custom words that trigger mentions (case insensitive)
+	Groups          []string // names of the groups the user is member of (without @)
+	ChannelMentions bool     // true if @channel, @all and @here trigger mentions
+}
+
+// types of mentions found in a message for a given user
+type Mentions struct {
+	Direct  bool // @username
+	Keyword bool // first name or custom mention keys
+	Group   bool // @group
+	Channel bool // @channel or @all
+	Here    bool // @here
+}
+
+func (m Mentions) IsMentioned() bool {
+	return m.Direct || m.Keyword || m.Group || m.Channel || m.Here
+}
+
+var codeBlockReg = regexp.MustCompile("(?s)```.*?```")
+var inlineCodeReg = regexp.MustCompile("`[^`\n]*`")
+
+// text in code blocks does not trigger mentions
+func removeCode(message string) string {
+	return inlineCodeReg.ReplaceAllString(codeBlockReg.ReplaceAllString(message, " "), " ")
+}
+
+// splits the message in words as Mattermost does when looking for mentions:
+// words are sequences of letters, numbers and the characters . - _ @ :
+func splitMentionWords(message string) []string {
+	return strings.FieldsFunc(message, func(c rune) bool {
+		return !(unicode.IsLetter(c) || unicode.IsNumber(c) || c == '.' || c == '-' || c == '_' || c == '@' || c == ':')
+	})
+}
+
+// checks a single word against the mention keys and updates the mentions found
+func (keys *MentionKeys) matchWord(word string, mentions *Mentions) bool {
+	lower := strings.ToLower(word)
+
+	switch {
+	case lower == "@"+strings.ToLower(keys.Username):
+		mentions.Direct = true
+	case lower == "@channel" || lower == "@all":
+		mentions.Channel = mentions.Channel || keys.ChannelMentions
+	case lower == "@here":
+		mentions.Here = mentions.Here || keys.ChannelMentions
+	case keys.FirstName != "" && word == keys.FirstName:
+		mentions.Keyword = true
+	default:
+		for _, g := range keys.Groups {
+			if lower == "@"+strings.ToLower(g) {
+				mentions.Group = true
+				return true
+			}
+		}
+		for _, k := range keys.Keys {
+			if lower == strings.ToLower(k) {
+				mentions.Keyword = true
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// returns the mentions for the user in the message
+func ParseMentions(message string, keys *MentionKeys) Mentions {
+	mentions := Mentions{}
+	message = removeCode(message)
+
+	for _, word := range splitMentionWords(message) {
+		// words can end with punctuation (e.g., "@john." or "@john:"), so
+		// if the whole word does not match, try again removing it
+		if !keys.matchWord(word, &mentions) {
+			keys.matchWord(strings.TrimRight(word, ".-_:"), &mentions)
+		}
+	}
+
+	// custom keys made of more than one word
+	for _, k := range keys.Keys {
+		if strings.Contains(strings.TrimSpace(k), " ") && len(MatchKeywords(message, []string{k})) > 0 {
+			mentions.Keyword = true
+		}
+	}
+
+	return mentions
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestingMentionKeys() *MentionKeys {
+	return &MentionKeys{
+		Username:        "bob",
+		FirstName:       "Robert",
+		Keys:            []string{"backend", "on call"},
+		Groups:          []string{"developers"},
+		ChannelMentions: true,
+	}
+}
+
+func TestParseMentions(t *testing.T) {
+	keys := getTestingMentionKeys()
+
+	assert.Equal(t, Mentions{Direct: true}, ParseMentions("hi @bob, how are you?", keys))
+	assert.Equal(t, Mentions{Direct: true}, ParseMentions("thanks @BOB.", keys))
+	assert.Equal(t, Mentions{}, ParseMentions("hi @bobby", keys))
+	assert.Equal(t, Mentions{}, ParseMentions("send it to bob@example.com", keys))
+	assert.Equal(t, Mentions{}, ParseMentions("`@bob` is a username", keys))
+	assert.Equal(t, Mentions{}, ParseMentions("```\n@bob\n```", keys))
+	assert.Equal(t, Mentions{Here: true}, ParseMentions("@here lunch?", keys))
+	assert.Equal(t, Mentions{Channel: true}, ParseMentions("@all: meeting now", keys))
+	assert.Equal(t, Mentions{Group: true}, ParseMentions("@developers please review", keys))
+	assert.Equal(t, Mentions{Keyword: true}, ParseMentions("Robert, can you check?", keys))
+	assert.Equal(t, Mentions{}, ParseMentions("robert, can you check?", keys))
+	assert.Equal(t, Mentions{Keyword: true}, ParseMentions("the Backend is down", keys))
+	assert.Equal(t, Mentions{Keyword: true}, ParseMentions("who is on call today?", keys))
+
+	keys.ChannelMentions = false
+	assert.Equal(t, Mentions{}, ParseMentions("@channel @here", keys))
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"golang.org/x/exp/slices"
 )
 
 type MANUserPreferences struct {
@@ -14,6 +16,74 @@ type MANUserPreferences struct {
 	IncludeCountPreviouslyNotified            bool
 	IncludeSystemMessages                     bool
 	IncludeMessagesFromBots                   bool
+	Schedule                                  string
+	QuietHours                                string
+	PausedUntil                               int64 // unix timestamp in milliseconds, 0 if not paused
+	Keywords                                  []string
+	DeliveryMethod                            string   // email or bot
+	ExcludedChannels                          []string // ids of the channels whose messages are not notified
+	IncludedChannels                          []string // ids of the channels notified even if muted in Mattermost
+	// preferences overridden in some teams, by team id ("" for direct messages)
+	Teams map[string]TeamPreferences
+	// if true, the missed activity in all teams is notified in a single digest
+	MergeTeams bool
+}
+
+func (p *MANUserPreferences) IsPausedAt(t time.Time) bool {
+	return p.PausedUntil > 0 && t.Before(time.UnixMilli(p.PausedUntil))
+}
+
+// returns a copy of the preferences that does not share slices and maps
+// with the original
+func (p *MANUserPreferences) Copy() MANUserPreferences {
+	res := *p
+	res.Keywords = slices.Clone(p.Keywords)
+	res.ExcludedChannels = slices.Clone(p.ExcludedChannels)
+	res.IncludedChannels = slices.Clone(p.IncludedChannels)
+	if p.Teams != nil {
+		res.Teams = p.copyTeams()
+	}
+	return res
+}
+
+func (p *MANUserPreferences) IsChannelExcluded(channelID string) bool {
+	return slices.Contains(p.ExcludedChannels, channelID)
+}
+
+func (p *MANUserPreferences) IsChannelIncluded(channelID string) bool {
+	return slices.Contains(p.IncludedChannels, channelID)
+}
+
+// how the user wants a channel to be notified
+const (
+	ChannelExclude = "exclude" // never notified
+	ChannelInclude = "include" // notified even if muted in Mattermost
+	ChannelReset   = "reset"   // notified according to the Mattermost channel preferences
+)
+
+func removeString(list []string, value string) []string {
+	res := []string{}
+	for _, v := range list {
+		if v != value {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// moves the channel in the excluded or included channels, or removes it
+// from both. The lists are copied, so the preferences can be modified
+// without affecting other copies
+func (p *MANUserPreferences) SetChannelSetting(channelID string, setting string) {
+	p.ExcludedChannels = removeString(p.ExcludedChannels, channelID)
+	p.IncludedChannels = removeString(p.IncludedChannels, channelID)
+
+	switch setting {
+	case ChannelExclude:
+		p.ExcludedChannels = append(p.ExcludedChannels, channelID)
+	case ChannelInclude:
+		p.IncludedChannels = append(p.IncludedChannels, channelID)
+	}
 }
 
 type TeamMissedActivity struct {
@@ -21,6 +91,31 @@ type TeamMissedActivity struct {
 	Team           *Team
 	UnreadChannels []ChannelMissedActivity
 	Logs           []string
+	// messages older than this timestamp have been already notified
+	// to the user in previous runs
+	LastNotifiedTimestamp time.Time
+	// id of the digest built from this missed activity, used to link its
+	// web version. Empty if the digest is not archived
+	DigestID string
+	// teams whose missed activity has been merged in this object (whose
+	// Team is AllTeamsFakeTeam), nil if not merged
+	MergedTeams []*Team
+}
+
+// true if there is no missed activity to notify
+func (uma *TeamMissedActivity) IsEmpty() bool {
+	return len(uma.UnreadChannels) == 0
+}
+
+// error computing the missed activity of a user in a run. The missed
+// activity of the user is not (or only partially) returned
+type UserRunError struct {
+	User *User
+	Err  error
+}
+
+func (e *UserRunError) Error() string {
+	return fmt.Sprintf("user %s: %s", e.User.Username, e.Err)
 }
 
 func (uma *TeamMissedActivity) AppendLog(message string, a ...any) {
@@ -43,12 +138,26 @@ func (p *Post) IsRoot() bool {
 	return p.RootID == ""
 }
 
+// read state of a thread for a user (from the Mattermost thread memberships)
+type ThreadMembership struct {
+	PostID      string
+	Following   bool
+	LastViewed  time.Time
+	LastReplyAt time.Time
+}
+
+func (tm *ThreadMembership) IsUnread() bool {
+	return tm.LastReplyAt.After(tm.LastViewed)
+}
+
 type UnreadConversation struct {
 	Following           bool
 	IsRootMessageUnread bool
 	RootPost            *Post
 	Replies             []*Post
 	MostRecentMessage   time.Time
+	// user's keywords found in the posts of the conversation (by post id)
+	MatchedKeywords map[string][]string
 }
 
 func (uc *UnreadConversation) IsAuthor(user *User) bool {
@@ -62,9 +171,18 @@ func NewUnreadConversation(rootPost *Post, following bool, rootPostUnread bool)
 		IsRootMessageUnread: rootPostUnread,
 		Replies:             []*Post{},
 		MostRecentMessage:   rootPost.CreatedAt,
+		MatchedKeywords:     map[string][]string{},
 	}
 }
 
+func (uc *UnreadConversation) SetMatchedKeywords(post *Post, keywords []string) {
+	uc.MatchedKeywords[post.ID] = keywords
+}
+
+func (uc *UnreadConversation) GetMatchedKeywords(post *Post) []string {
+	return uc.MatchedKeywords[post.ID]
+}
+
 func (uc *UnreadConversation) AppendReply(post *Post) {
 	uc.Replies = append(uc.Replies, post)
 	if uc.MostRecentMessage.Before(post.CreatedAt) {
@@ -87,6 +205,29 @@ type User struct {
 	Image          []byte
 	MANPreferences MANUserPreferences
 	AltText        string // alternative text to show if the user photo cannot be visualized (e.g. in GMail client)
+	Timezone       string // IANA name of the timezone of the user (e.g., Europe/Rome)
+	Locale         string // language of the user (e.g., en, it)
+	MentionKeys    MentionKeys
+	NotifyProps    map[string]string // Mattermost notification preferences
+	EmailInterval  time.Duration     // interval of Mattermost batched emails, 0 if not set
+	// true if the user reads replies in the Threads view, so replies are
+	// read per thread instead of per channel
+	CollapsedThreads bool
+	// true if the user shows times with a 24 hours clock
+	UseMilitaryTime bool
+}
+
+func (u *User) GetMentions(message string) Mentions {
+	return ParseMentions(message, &u.MentionKeys)
+}
+
+// returns the location of the user timezone, UTC if unknown
+func (u *User) Location() *time.Location {
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
 }
 
 func (u *User) IsAdmin() bool {
@@ -115,10 +256,14 @@ var (
 	// fake team to handle direct messages. Direct Messages does not belong
 	// to a particular Team, so to manage them uniformely we use this special team
 	DirectMessagesFakeTeam = &Team{Name: "Direct Messages", ID: ""}
+	// fake team of the digests that merge the missed activity of all
+	// the teams of the user (see MANUserPreferences.MergeTeams)
+	AllTeamsFakeTeam = &Team{Name: "All Teams", ID: "all"}
 )
 
 type Channel struct {
 	ID          string
+	Name        string
 	DisplayName string
 	Members     []string
 	Type        string
@@ -133,11 +278,23 @@ func (ch *Channel) IsGroup() bool {
 	return ch.Type == "G"
 }
 
+// the decision taken on a post while computing the missed activity
+type PostDecision struct {
+	PostID   string
+	Message  string
+	Filter   string // name of the filter that took the decision, empty if no filter did
+	Decision string
+	Reason   string
+}
+
 type ChannelMissedActivity struct {
 	Channel                    *Channel
 	User                       *User
 	UnreadConversations        []*UnreadConversation
 	Logs                       []string
+	Decisions                  []PostDecision
+	ChannelNotifyProps         map[string]string // notification preferences of the user for the channel
+	Policy                     *ChannelPolicy    // admin policy applied to the channel, nil if none
 	RepliesInNotFollowingConvs int
 	NotifiedByMMMessages       int
 	PreviouslyNotified         int
@@ -158,6 +315,15 @@ func (cma *ChannelMissedActivity) AppendLog(message string, a ...any) {
 	cma.Logs = append(cma.Logs, fmt.Sprintf(message, a...))
 }
 
+// true if the user disabled @channel, @all and @here mentions for the channel
+func (cma *ChannelMissedActivity) IgnoresChannelMentions() bool {
+	return cma.ChannelNotifyProps["ignore_channel_mentions"] == "on"
+}
+
+func (cma *ChannelMissedActivity) AppendDecision(decision PostDecision) {
+	cma.Decisions = append(cma.Decisions, decision)
+}
+
 func (cma *ChannelMissedActivity) GetChannelName() string {
 	return cma.Channel.GetChannelName(cma.User)
 }
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetChannelSetting(t *testing.T) {
+	prefs := MANUserPreferences{ExcludedChannels: []string{"c1"}}
+	excluded := prefs.ExcludedChannels
+
+	prefs.SetChannelSetting("c2", ChannelExclude)
+	prefs.SetChannelSetting("c1", ChannelInclude)
+	assert.Equal(t, []string{"c2"}, prefs.ExcludedChannels)
+	assert.Equal(t, []string{"c1"}, prefs.IncludedChannels)
+	assert.True(t, prefs.IsChannelExcluded("c2"))
+	assert.True(t, prefs.IsChannelIncluded("c1"))
+	// the original list is not modified
+	assert.Equal(t, []string{"c1"}, excluded)
+
+	prefs.SetChannelSetting("c2", ChannelReset)
+	assert.Empty(t, prefs.ExcludedChannels)
+	assert.False(t, prefs.IsChannelExcluded("c2"))
+}
+
+func TestPreferencesForTeam(t *testing.T) {
+	prefs := MANUserPreferences{IncludeMessagesFromBots: true}
+	prefs.SetTeamOverride("team1", "IncludeMessagesFromBots", false)
+	prefs.SetTeamEnabled("team2", false)
+
+	assert.False(t, prefs.ForTeam("team1").IncludeMessagesFromBots)
+	assert.True(t, prefs.ForTeam("team2").IncludeMessagesFromBots)
+	assert.True(t, prefs.IsTeamEnabled("team1"))
+	assert.False(t, prefs.IsTeamEnabled("team2"))
+
+	prefs.ResetTeam("team2")
+	assert.True(t, prefs.IsTeamEnabled("team2"))
+}
+
+func TestPreferencesCopy(t *testing.T) {
+	prefs := MANUserPreferences{Keywords: []string{"release"}, ExcludedChannels: []string{"ch1"}}
+	prefs.SetTeamEnabled("team1", false)
+
+	c := prefs.Copy()
+	c.Keywords[0] = "deploy"
+	c.ExcludedChannels = append(c.ExcludedChannels[:0], "ch2")
+	c.SetTeamEnabled("team1", true)
+	c.Teams["team2"] = TeamPreferences{Disabled: true}
+
+	assert.Equal(t, []string{"release"}, prefs.Keywords)
+	assert.Equal(t, []string{"ch1"}, prefs.ExcludedChannels)
+	assert.False(t, prefs.IsTeamEnabled("team1"))
+	assert.True(t, prefs.IsTeamEnabled("team2"))
+	assert.Nil(t, (&MANUserPreferences{}).Copy().Teams)
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"time"
+)
+
+// backoff after the first failed attempt. It doubles at each new failure
+const OutboxRetryBaseInterval = 15 * time.Minute
+
+// backoff is never longer than this
+const OutboxRetryMaxInterval = 24 * time.Hour
+
+// a rendered digest that could not be sent and that will be retried in the next runs
+type OutboxEntry struct {
+	ID       string
+	UserID   string
+	Username string
+	TeamName string
+	Method   string // delivery method, email if empty
+	Subject  string
+	Body     string
+	Text     string // plain text version of the body, if any
+	Thread   string
+	// web version of the digest, archived when the digest is sent
+	Archived      *ArchivedDigest
+	CreatedAt     int64
+	Attempts      int
+	NextAttemptAt int64
+	LastError     string
+	// true if the max number of attempts has been reached. Failed
+	// entries are not retried anymore, unless an admin asks so
+	Failed bool
+}
+
+// returns the time to wait before the next attempt, after the given number of failed attempts
+func OutboxBackoff(attempts int) time.Duration {
+	backoff := OutboxRetryBaseInterval
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= OutboxRetryMaxInterval {
+			return OutboxRetryMaxInterval
+		}
+	}
+	return backoff
+}
+
+// records a failed attempt. If the max number of attempts has been reached,
+// the entry is marked as failed, otherwise the next attempt is scheduled
+func (e *OutboxEntry) RecordFailure(now time.Time, err error, maxAttempts int) {
+	e.Attempts++
+	e.LastError = err.Error()
+	if e.Attempts >= maxAttempts {
+		e.Failed = true
+		return
+	}
+	e.NextAttemptAt = now.Add(OutboxBackoff(e.Attempts)).UnixMilli()
+}
+
+func (e *OutboxEntry) IsDue(now time.Time) bool {
+	return !e.Failed && e.NextAttemptAt <= now.UnixMilli()
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	assert.Equal(t, 15*time.Minute, OutboxBackoff(1))
+	assert.Equal(t, 30*time.Minute, OutboxBackoff(2))
+	assert.Equal(t, 60*time.Minute, OutboxBackoff(3))
+	assert.Equal(t, 24*time.Hour, OutboxBackoff(20))
+}
+
+func TestOutboxEntryRecordFailure(t *testing.T) {
+	now := time.UnixMilli(1000000)
+	e := &OutboxEntry{}
+
+	e.RecordFailure(now, errors.New("smtp error"), 2)
+	assert.Equal(t, 1, e.Attempts)
+	assert.False(t, e.Failed)
+	assert.Equal(t, now.Add(15*time.Minute).UnixMilli(), e.NextAttemptAt)
+	assert.False(t, e.IsDue(now))
+	assert.True(t, e.IsDue(now.Add(15*time.Minute)))
+
+	e.RecordFailure(now, errors.New("smtp error"), 2)
+	assert.Equal(t, 2, e.Attempts)
+	assert.True(t, e.Failed)
+	assert.False(t, e.IsDue(now.Add(time.Hour)))
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// modes of the channel policies set by the administrators
+const (
+	PolicyAlways = "always" // the channel is always notified, also replies in not followed threads
+	PolicyNever  = "never"  // the channel is never notified
+)
+
+// a policy set by the administrators for the channels matching it. Policies
+// do not apply to direct and group messages
+type ChannelPolicy struct {
+	Mode    string // PolicyAlways or PolicyNever
+	TeamID  string // empty for all teams
+	Channel string // channel id or pattern of channel names (e.g., "bot-*")
+}
+
+func (p *ChannelPolicy) Validate() error {
+	if p.Mode != PolicyAlways && p.Mode != PolicyNever {
+		return errors.Errorf("invalid policy mode '%s'", p.Mode)
+	}
+	if p.Channel == "" {
+		return errors.New("missing channel")
+	}
+	if _, err := path.Match(p.Channel, ""); err != nil {
+		return errors.Errorf("invalid channel pattern '%s'", p.Channel)
+	}
+	return nil
+}
+
+func (p *ChannelPolicy) Matches(channel *Channel) bool {
+	if channel.TeamID == "" || (p.TeamID != "" && p.TeamID != channel.TeamID) {
+		return false
+	}
+	if p.Channel == channel.ID {
+		return true
+	}
+	matched, _ := path.Match(p.Channel, channel.Name)
+	return matched
+}
+
+type ChannelPolicies []*ChannelPolicy
+
+// returns the policy applied to the channel, nil if none. If the channel
+// matches both kinds of policies, PolicyNever wins
+func (ps ChannelPolicies) ForChannel(channel *Channel) *ChannelPolicy {
+	var res *ChannelPolicy
+	for _, p := range ps {
+		if !p.Matches(channel) {
+			continue
+		}
+		if p.Mode == PolicyNever {
+			return p
+		}
+		if res == nil {
+			res = p
+		}
+	}
+	return res
+}
+
+// how a channel is handled for a user, in order of precedence
+const (
+	ChannelPolicyNever  = "policy_never"  // never notified, by an admin policy
+	ChannelPolicyAlways = "policy_always" // always notified, by an admin policy
+	ChannelExcluded     = "excluded"      // excluded by the user
+	ChannelMuted        = "muted"         // muted in Mattermost
+	ChannelIncluded     = "included"      // muted in Mattermost, but included by the user
+	ChannelNotified     = "notified"      // notified according to the preferences of the user
+)
+
+// returns how the channel of the membership is handled for its user and the
+// policy applied, if any. Admin policies come before the preferences of the user
+func GetChannelStatus(policies ChannelPolicies, cm *ChannelMembership) (string, *ChannelPolicy) {
+	policy := policies.ForChannel(cm.Channel)
+	if policy != nil {
+		if policy.Mode == PolicyNever {
+			return ChannelPolicyNever, policy
+		}
+		return ChannelPolicyAlways, policy
+	}
+
+	prefs := &cm.User.MANPreferences
+	switch {
+	case prefs.IsChannelExcluded(cm.Channel.ID):
+		return ChannelExcluded, nil
+	case cm.IsMuted() && prefs.IsChannelIncluded(cm.Channel.ID):
+		return ChannelIncluded, nil
+	case cm.IsMuted():
+		return ChannelMuted, nil
+	}
+	return ChannelNotified, nil
+}
+
+// true if the messages of the channel are notified
+func IsChannelStatusNotified(status string) bool {
+	return status == ChannelPolicyAlways || status == ChannelIncluded || status == ChannelNotified
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelPolicies(t *testing.T) {
+	announcements := &Channel{ID: "ch1", Name: "announcements", TeamID: "team1"}
+	bots := &Channel{ID: "ch2", Name: "bot-alerts", TeamID: "team1"}
+	direct := &Channel{ID: "ch3", Name: "user1__user2", Type: "D"}
+
+	policies := ChannelPolicies{
+		{Mode: PolicyAlways, Channel: "ch1"},
+		{Mode: PolicyAlways, Channel: "bot-*", TeamID: "team1"},
+		{Mode: PolicyNever, Channel: "bot-*", TeamID: "team1"},
+		{Mode: PolicyNever, Channel: "*", TeamID: "team2"},
+	}
+
+	assert.Equal(t, policies[0], policies.ForChannel(announcements))
+	// never wins over always
+	assert.Equal(t, policies[2], policies.ForChannel(bots))
+	assert.Nil(t, policies.ForChannel(direct))
+
+	assert.Nil(t, (&ChannelPolicy{Mode: PolicyNever, Channel: "bot-*"}).Validate())
+	assert.NotNil(t, (&ChannelPolicy{Mode: "sometimes", Channel: "bot-*"}).Validate())
+	assert.NotNil(t, (&ChannelPolicy{Mode: PolicyNever, Channel: "bot-["}).Validate())
+}
+
+func TestGetChannelStatus(t *testing.T) {
+	user := &User{ID: "user1", MANPreferences: MANUserPreferences{
+		ExcludedChannels: []string{"ch1", "ch2"},
+		IncludedChannels: []string{"ch3"},
+	}}
+	muted := map[string]string{"mark_unread": "mention"}
+	policies := ChannelPolicies{{Mode: PolicyAlways, Channel: "ch1"}}
+
+	membership := func(id string, notifyProps map[string]string) *ChannelMembership {
+		return &ChannelMembership{Channel: &Channel{ID: id, Name: id, TeamID: "team1"}, User: user, NotifyProps: notifyProps}
+	}
+
+	status, policy := GetChannelStatus(policies, membership("ch1", muted))
+	assert.Equal(t, ChannelPolicyAlways, status)
+	assert.Equal(t, policies[0], policy)
+
+	status, policy = GetChannelStatus(policies, membership("ch2", nil))
+	assert.Equal(t, ChannelExcluded, status)
+	assert.Nil(t, policy)
+
+	status, _ = GetChannelStatus(policies, membership("ch3", muted))
+	assert.Equal(t, ChannelIncluded, status)
+	status, _ = GetChannelStatus(policies, membership("ch4", muted))
+	assert.Equal(t, ChannelMuted, status)
+	status, _ = GetChannelStatus(policies, membership("ch4", nil))
+	assert.Equal(t, ChannelNotified, status)
+}
@@ -0,0 +1,223 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A delivery schedule defines at which times (in the user's timezone) the
+// missed activity can be notified to a user. An empty schedule means that the
+// user is notified at every run.
+//
+// A schedule is a list of entries separated by ";". Each entry is an optional
+// set of days followed by one or more times separated by ",". Examples:
+//
+//	08:30
+//	08:30, 17:00
+//	mon-fri 08:30
+//	weekdays 08:30; sat 10:00
+//	mon,wed,fri 09:00, 14:00
+//	mon, wed 09:00
+type Schedule struct {
+	Entries []ScheduleEntry
+}
+
+type ScheduleEntry struct {
+	Days  [7]bool // indexed by time.Weekday
+	Times []int   // minutes from midnight
+}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// accepts full day names (e.g., "monday") and their 3-letter abbreviations
+func parseWeekday(name string) (time.Weekday, error) {
+	value := strings.ToLower(strings.TrimSpace(name))
+	for i, n := range weekdayNames {
+		if value == n || value == strings.ToLower(time.Weekday(i).String()) {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day '%s'", name)
+}
+
+func parseScheduleDays(spec string) ([7]bool, error) {
+	var days [7]bool
+
+	switch strings.ToLower(spec) {
+	case "daily":
+		return [7]bool{true, true, true, true, true, true, true}, nil
+	case "weekdays":
+		return [7]bool{false, true, true, true, true, true, false}, nil
+	case "weekends":
+		return [7]bool{true, false, false, false, false, false, true}, nil
+	}
+
+	for _, token := range strings.Split(spec, ",") {
+		if from, to, isRange := strings.Cut(token, "-"); isRange {
+			fromDay, errF := parseWeekday(from)
+			if errF != nil {
+				return days, errF
+			}
+			toDay, errT := parseWeekday(to)
+			if errT != nil {
+				return days, errT
+			}
+			// ranges can wrap around the end of the week (e.g., fri-mon)
+			for d := fromDay; ; d = (d + 1) % 7 {
+				days[d] = true
+				if d == toDay {
+					break
+				}
+			}
+		} else {
+			day, err := parseWeekday(token)
+			if err != nil {
+				return days, err
+			}
+			days[day] = true
+		}
+	}
+
+	return days, nil
+}
+
+// parses times in the HH:MM format and returns the number of minutes from midnight
+func parseTimeOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s' (expected format is HH:MM)", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func parseScheduleEntry(spec string) (ScheduleEntry, error) {
+	entry := ScheduleEntry{Days: [7]bool{true, true, true, true, true, true, true}}
+
+	spec = strings.TrimSpace(spec)
+	times := spec
+
+	// if the entry does not start with a digit, the list of days comes before
+	// the first time. Days can be separated by spaces (e.g., "mon, tue 09:00")
+	if spec != "" && (spec[0] < '0' || spec[0] > '9') {
+		i := strings.IndexAny(spec, "0123456789")
+		if i < 0 {
+			i = len(spec)
+		}
+		days, err := parseScheduleDays(strings.TrimSpace(spec[:i]))
+		if err != nil {
+			return entry, err
+		}
+		entry.Days = days
+		times = spec[i:]
+	}
+
+	for _, t := range strings.Split(times, ",") {
+		minutes, err := parseTimeOfDay(t)
+		if err != nil {
+			return entry, err
+		}
+		entry.Times = append(entry.Times, minutes)
+	}
+
+	return entry, nil
+}
+
+func ParseSchedule(spec string) (*Schedule, error) {
+	res := &Schedule{Entries: []ScheduleEntry{}}
+
+	if strings.TrimSpace(spec) == "" {
+		return res, nil
+	}
+
+	for _, entrySpec := range strings.Split(spec, ";") {
+		entry, err := parseScheduleEntry(entrySpec)
+		if err != nil {
+			return nil, err
+		}
+		res.Entries = append(res.Entries, entry)
+	}
+
+	return res, nil
+}
+
+// true if the schedule does not restrict the delivery times
+func (s *Schedule) IsAlways() bool {
+	return len(s.Entries) == 0
+}
+
+// returns true if at least one of the delivery times of the schedule falls
+// in the (from, to] interval. Delivery times are interpreted in the given location
+func (s *Schedule) HasDeliveryTimeBetween(from time.Time, to time.Time, loc *time.Location) bool {
+	if s.IsAlways() {
+		return true
+	}
+
+	if !from.Before(to) {
+		return false
+	}
+
+	from = from.In(loc)
+	to = to.In(loc)
+
+	// one week is enough to check all the possible delivery times
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i <= 7 && !day.After(to); i++ {
+		for _, entry := range s.Entries {
+			if !entry.Days[day.Weekday()] {
+				continue
+			}
+			for _, minutes := range entry.Times {
+				t := time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, loc)
+				if t.After(from) && !t.After(to) {
+					return true
+				}
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return false
+}
+
+// Quiet hours define a time interval of the day (in the user's timezone) in
+// which notifications are not delivered. The interval can span midnight
+// (e.g., 20:00-07:00)
+type QuietHours struct {
+	From int // minutes from midnight
+	To   int // minutes from midnight
+}
+
+// parses quiet hours in the HH:MM-HH:MM format. It returns nil if the spec is empty
+func ParseQuietHours(spec string) (*QuietHours, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	from, to, found := strings.Cut(spec, "-")
+	if !found {
+		return nil, fmt.Errorf("invalid quiet hours '%s' (expected format is HH:MM-HH:MM)", spec)
+	}
+
+	fromMinutes, errF := parseTimeOfDay(from)
+	if errF != nil {
+		return nil, errF
+	}
+	toMinutes, errT := parseTimeOfDay(to)
+	if errT != nil {
+		return nil, errT
+	}
+
+	return &QuietHours{From: fromMinutes, To: toMinutes}, nil
+}
+
+// true if the given time, in the given location, is inside the quiet hours
+func (q *QuietHours) Contains(t time.Time, loc *time.Location) bool {
+	t = t.In(loc)
+	minutes := t.Hour()*60 + t.Minute()
+
+	if q.From <= q.To {
+		return minutes >= q.From && minutes < q.To
+	}
+	return minutes >= q.From || minutes < q.To
+}
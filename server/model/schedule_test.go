@@ -0,0 +1,105 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchedule(t *testing.T) {
+	s, err := ParseSchedule("weekdays 08:30; sat 10:00, 18:15")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(s.Entries))
+	assert.Equal(t, [7]bool{false, true, true, true, true, true, false}, s.Entries[0].Days)
+	assert.Equal(t, []int{510}, s.Entries[0].Times)
+	assert.Equal(t, [7]bool{false, false, false, false, false, false, true}, s.Entries[1].Days)
+	assert.Equal(t, []int{600, 1095}, s.Entries[1].Times)
+
+	s2, err2 := ParseSchedule("fri-mon 09:00")
+	assert.Nil(t, err2)
+	assert.Equal(t, [7]bool{true, true, false, false, false, true, true}, s2.Entries[0].Days)
+
+	s3, err3 := ParseSchedule("")
+	assert.Nil(t, err3)
+	assert.True(t, s3.IsAlways())
+
+	_, err4 := ParseSchedule("mon-fri")
+	assert.NotNil(t, err4)
+
+	_, err5 := ParseSchedule("someday 08:00")
+	assert.NotNil(t, err5)
+
+	_, err6 := ParseSchedule("25:00")
+	assert.NotNil(t, err6)
+
+	s7, err7 := ParseSchedule("Monday,friday 09:00")
+	assert.Nil(t, err7)
+	assert.Equal(t, [7]bool{false, true, false, false, false, true, false}, s7.Entries[0].Days)
+
+	// days can be separated by spaces
+	for _, spec := range []string{"mon, tue 09:00", "mon ,tue 09:00", "mon , tue 09:00, 17:00", "mon - tue 09:00"} {
+		s8, err8 := ParseSchedule(spec)
+		assert.Nil(t, err8, spec)
+		assert.Equal(t, [7]bool{false, true, true, false, false, false, false}, s8.Entries[0].Days, spec)
+		assert.Equal(t, 540, s8.Entries[0].Times[0], spec)
+	}
+
+	// only full names and exact abbreviations are days
+	for _, spec := range []string{"monkey 08:00", "sunshine 08:00", "mo 08:00", "mon-fridays 08:00"} {
+		_, errD := ParseSchedule(spec)
+		assert.NotNil(t, errD, spec)
+	}
+}
+
+func TestScheduleHasDeliveryTimeBetween(t *testing.T) {
+	rome, _ := time.LoadLocation("Europe/Rome")
+	s, _ := ParseSchedule("mon-fri 08:30")
+
+	// Wednesday 2023-11-15 07:30 UTC is 08:30 in Rome
+	assert.True(t, s.HasDeliveryTimeBetween(
+		time.Date(2023, 11, 15, 7, 0, 0, 0, time.UTC),
+		time.Date(2023, 11, 15, 8, 0, 0, 0, time.UTC), rome))
+
+	// same interval, but in UTC the delivery time has not been reached yet
+	assert.False(t, s.HasDeliveryTimeBetween(
+		time.Date(2023, 11, 15, 7, 0, 0, 0, time.UTC),
+		time.Date(2023, 11, 15, 8, 0, 0, 0, time.UTC), time.UTC))
+
+	// Saturday
+	assert.False(t, s.HasDeliveryTimeBetween(
+		time.Date(2023, 11, 18, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 11, 18, 23, 0, 0, 0, time.UTC), rome))
+
+	// from Saturday to Monday morning
+	assert.True(t, s.HasDeliveryTimeBetween(
+		time.Date(2023, 11, 18, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 11, 20, 9, 0, 0, 0, time.UTC), rome))
+
+	always, _ := ParseSchedule("")
+	assert.True(t, always.HasDeliveryTimeBetween(time.Now(), time.Now(), rome))
+}
+
+func TestQuietHours(t *testing.T) {
+	rome, _ := time.LoadLocation("Europe/Rome")
+
+	q, err := ParseQuietHours("20:00-07:00")
+	assert.Nil(t, err)
+	assert.True(t, q.Contains(time.Date(2023, 11, 15, 22, 0, 0, 0, rome), rome))
+	assert.True(t, q.Contains(time.Date(2023, 11, 15, 6, 59, 0, 0, rome), rome))
+	assert.False(t, q.Contains(time.Date(2023, 11, 15, 7, 0, 0, 0, rome), rome))
+	// 19:30 UTC is 20:30 in Rome
+	assert.True(t, q.Contains(time.Date(2023, 11, 15, 19, 30, 0, 0, time.UTC), rome))
+
+	q2, err2 := ParseQuietHours("12:00-14:00")
+	assert.Nil(t, err2)
+	assert.True(t, q2.Contains(time.Date(2023, 11, 15, 13, 0, 0, 0, rome), rome))
+	assert.False(t, q2.Contains(time.Date(2023, 11, 15, 15, 0, 0, 0, rome), rome))
+
+	q3, err3 := ParseQuietHours("")
+	assert.Nil(t, err3)
+	assert.Nil(t, q3)
+
+	_, err4 := ParseQuietHours("20:00")
+	assert.NotNil(t, err4)
+}
@@ -0,0 +1,138 @@
+package model
+
+import (
+	"fmt"
+)
+
+// boolean preferences that can be overridden in a team
+var TeamPreferenceNames = []string{
+	"NotifyRepliesInNotFollowedThreads",
+	"IncludeCountOfRepliesInNotFollowedThreads",
+	"InlcudeCountOfMessagesNotifiedByMM",
+	"IncludeCountPreviouslyNotified",
+	"IncludeSystemMessages",
+	"IncludeMessagesFromBots",
+}
+
+// preferences of the user in a team
+type TeamPreferences struct {
+	Disabled  bool            // if true, the missed activity in the team is not notified
+	Overrides map[string]bool // values of the preferences in TeamPreferenceNames
+}
+
+func IsTeamPreferenceName(name string) bool {
+	for _, n := range TeamPreferenceNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *MANUserPreferences) IsTeamEnabled(teamID string) bool {
+	return !p.Teams[teamID].Disabled
+}
+
+// returns the preferences of the user in the team, with the overrides applied
+func (p *MANUserPreferences) ForTeam(teamID string) MANUserPreferences {
+	res := *p
+	for name, value := range p.Teams[teamID].Overrides {
+		switch name {
+		case "NotifyRepliesInNotFollowedThreads":
+			res.NotifyRepliesInNotFollowedThreads = value
+		case "IncludeCountOfRepliesInNotFollowedThreads":
+			res.IncludeCountOfRepliesInNotFollowedThreads = value
+		case "InlcudeCountOfMessagesNotifiedByMM":
+			res.InlcudeCountOfMessagesNotifiedByMM = value
+		case "IncludeCountPreviouslyNotified":
+			res.IncludeCountPreviouslyNotified = value
+		case "IncludeSystemMessages":
+			res.IncludeSystemMessages = value
+		case "IncludeMessagesFromBots":
+			res.IncludeMessagesFromBots = value
+		}
+	}
+	return res
+}
+
+// returns a copy of the preferences of the teams, so they can be modified
+// without affecting other copies of the user preferences
+func (p *MANUserPreferences) copyTeams() map[string]TeamPreferences {
+	res := map[string]TeamPreferences{}
+	for teamID, tp := range p.Teams {
+		overrides := map[string]bool{}
+		for k, v := range tp.Overrides {
+			overrides[k] = v
+		}
+		res[teamID] = TeamPreferences{Disabled: tp.Disabled, Overrides: overrides}
+	}
+	return res
+}
+
+func (p *MANUserPreferences) SetTeamEnabled(teamID string, enabled bool) {
+	p.Teams = p.copyTeams()
+	tp := p.Teams[teamID]
+	tp.Disabled = !enabled
+	p.Teams[teamID] = tp
+}
+
+func (p *MANUserPreferences) SetTeamOverride(teamID string, name string, value bool) {
+	p.Teams = p.copyTeams()
+	tp := p.Teams[teamID]
+	if tp.Overrides == nil {
+		tp.Overrides = map[string]bool{}
+	}
+	tp.Overrides[name] = value
+	p.Teams[teamID] = tp
+}
+
+// removes the preferences of the team, so the global ones are used
+func (p *MANUserPreferences) ResetTeam(teamID string) {
+	p.Teams = p.copyTeams()
+	delete(p.Teams, teamID)
+}
+
+// returns the teams of the missed activity (more than one if merged)
+func (uma *TeamMissedActivity) GetTeams() []*Team {
+	if uma.MergedTeams != nil {
+		return uma.MergedTeams
+	}
+	return []*Team{uma.Team}
+}
+
+// returns the name of the channel. In merged digests, the name of the
+// team is added to the channels of the teams
+func (uma *TeamMissedActivity) GetChannelName(cma *ChannelMissedActivity) string {
+	if uma.MergedTeams == nil || cma.Channel.TeamID == "" {
+		return cma.GetChannelName()
+	}
+	for _, t := range uma.MergedTeams {
+		if t.ID == cma.Channel.TeamID {
+			return fmt.Sprintf("%s (%s)", cma.GetChannelName(), t.Name)
+		}
+	}
+	return cma.GetChannelName()
+}
+
+// merges the missed activity of the user in several teams in a single
+// object, to be notified in a single digest
+func MergeTeamMissedActivities(user *User, activities []*TeamMissedActivity) *TeamMissedActivity {
+	res := &TeamMissedActivity{
+		User:           user,
+		Team:           AllTeamsFakeTeam,
+		UnreadChannels: []ChannelMissedActivity{},
+		Logs:           []string{},
+		MergedTeams:    []*Team{},
+	}
+
+	for i, a := range activities {
+		res.UnreadChannels = append(res.UnreadChannels, a.UnreadChannels...)
+		res.Logs = append(res.Logs, a.Logs...)
+		res.MergedTeams = append(res.MergedTeams, a.GetTeams()...)
+		if i == 0 || a.LastNotifiedTimestamp.Before(res.LastNotifiedTimestamp) {
+			res.LastNotifiedTimestamp = a.LastNotifiedTimestamp
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,52 @@
+package model
+
+// kinds of email templates that can be customized
+const (
+	HTMLTemplate    = "html"
+	TextTemplate    = "text"
+	SubjectTemplate = "subject"
+)
+
+var EmailTemplateKinds = []string{HTMLTemplate, TextTemplate, SubjectTemplate}
+
+// email templates customized by the administrators. Empty templates are
+// replaced by the ones bundled with the plugin
+type EmailTemplates struct {
+	HTML      string
+	Text      string
+	Subject   string
+	UpdatedAt int64
+	UpdatedBy string
+}
+
+func IsEmailTemplateKind(kind string) bool {
+	for _, k := range EmailTemplateKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *EmailTemplates) Get(kind string) string {
+	switch kind {
+	case HTMLTemplate:
+		return t.HTML
+	case TextTemplate:
+		return t.Text
+	case SubjectTemplate:
+		return t.Subject
+	}
+	return ""
+}
+
+func (t *EmailTemplates) Set(kind string, source string) {
+	switch kind {
+	case HTMLTemplate:
+		t.HTML = source
+	case TextTemplate:
+		t.Text = source
+	case SubjectTemplate:
+		t.Subject = source
+	}
+}
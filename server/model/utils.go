@@ -2,8 +2,45 @@ package model
 
 import (
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-func MessageContainsMentions(message string, username string) bool {
-	return strings.Contains(message, "@all") || strings.Contains(message, "@channel") || strings.Contains(message, "@"+username)
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// returns the keywords found in the message. The match is case insensitive
+// and keywords must not be part of a longer word (e.g., "deploy" does not
+// match "deployment")
+func MatchKeywords(message string, keywords []string) []string {
+	res := []string{}
+	lowerMessage := strings.ToLower(message)
+
+	for _, keyword := range keywords {
+		k := strings.ToLower(strings.TrimSpace(keyword))
+		if k == "" {
+			continue
+		}
+
+		for offset := 0; offset < len(lowerMessage); {
+			i := strings.Index(lowerMessage[offset:], k)
+			if i < 0 {
+				break
+			}
+			start := offset + i
+			end := start + len(k)
+
+			before, _ := utf8.DecodeLastRuneInString(lowerMessage[:start])
+			after, _ := utf8.DecodeRuneInString(lowerMessage[end:])
+
+			if (start == 0 || !isWordRune(before)) && (end == len(lowerMessage) || !isWordRune(after)) {
+				res = append(res, keyword)
+				break
+			}
+			offset = end
+		}
+	}
+
+	return res
 }
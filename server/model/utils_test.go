@@ -0,0 +1,18 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchKeywords(t *testing.T) {
+	keywords := []string{"deploy", "Outage", "@backend-team", "release notes"}
+
+	assert.Equal(t, []string{"deploy"}, MatchKeywords("We will Deploy tomorrow", keywords))
+	assert.Equal(t, []string{}, MatchKeywords("the deployment is done", keywords))
+	assert.Equal(t, []string{"deploy", "Outage"}, MatchKeywords("redeploy or deploy? outage!", keywords))
+	assert.Equal(t, []string{"@backend-team"}, MatchKeywords("ping @backend-team, please", keywords))
+	assert.Equal(t, []string{"release notes"}, MatchKeywords("see the release notes.", keywords))
+	assert.Equal(t, []string{}, MatchKeywords("nothing here", []string{}))
+}
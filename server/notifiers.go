@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/delivery"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/output"
+)
+
+// values of the EmailSender setting
+const (
+	// multipart emails sent with the smtp server configured in Mattermost
+	emailSenderSMTP = "smtp"
+	// html only emails sent with the plugin API. It is the default, also
+	// used if the setting is empty
+	emailSenderMattermost = "mattermost"
+)
+
+func (p *MANPlugin) getEmailTemplateProps() *output.EmailTemplateProps {
+	// if the templates cannot be loaded, the bundled ones are used
+	templates, err := p.backend.GetEmailTemplates(false)
+	if err != nil {
+		p.backend.LogError("Error loading the custom email templates: %s", err)
+	}
+
+	return &output.EmailTemplateProps{
+		Templates:   templates,
+		TimeFormat:  p.configuration.TimestampFormat,
+		SubTitle:    p.configuration.EmailSubTitle,
+		ButtonText:  p.configuration.EmailButtonText,
+		FooterLine1: p.configuration.EmailFooterLine1,
+		FooterLine2: p.configuration.EmailFooterLine2,
+		FooterLine3: p.configuration.EmailFooterLine3,
+	}
+}
+
+// returns the notifiers for the available delivery methods
+func (p *MANPlugin) getNotifiers() delivery.Notifiers {
+	notifiers := delivery.NewNotifiers(
+		delivery.NewEmailNotifier(p.backend, p.getEmailTemplateProps(), p.configuration.EmailSender == emailSenderSMTP),
+	)
+	// without the bot, digests of users that chose direct messages fall
+	// back to email
+	if p.backend.IsBotAvailable() {
+		bot := delivery.NewBotNotifier(p.backend, p.configuration.TimestampFormat)
+		notifiers[bot.Name()] = bot
+	}
+	if p.configuration.WebhookURL != "" {
+		webhook := delivery.NewWebhookNotifier(p.backend, p.configuration.WebhookURL, p.configuration.WebhookSecret)
+		notifiers[webhook.Name()] = webhook
+	}
+	return notifiers
+}
+
+// posts the digest to the webhook. Requests that fail are stored in the
+// outbox, the delivery to the user is not affected
+func (p *MANPlugin) sendToWebhook(webhook delivery.Notifier, missedActivity *model.TeamMissedActivity, execLogs *MANRunLog) {
+	msg, errM := webhook.Render(missedActivity)
+	if errM != nil {
+		p.backend.LogError("Error rendering webhook digest: %s", errM)
+		return
+	}
+	if msg == nil || p.configuration.DryRun {
+		return
+	}
+
+	errS := webhook.Send(missedActivity.User, msg)
+	if errS == nil {
+		return
+	}
+
+	p.backend.LogError("Error sending digest to the webhook: %s", errS)
+	if errQ := p.enqueueDigest(missedActivity, webhook.Name(), msg, nil, errS); errQ != nil {
+		p.backend.LogError("Cannot store webhook digest in the outbox: %s", errQ)
+		return
+	}
+	execLogs.textLogs = append(execLogs.textLogs, fmt.Sprintf("Outbox: error sending digest '%s' for user %s to the webhook, it will be retried: %s", msg.Subject, missedActivity.User.Username, errS))
+}
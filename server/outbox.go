@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	mm_model "github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/delivery"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+// default number of attempts before a digest is marked as failed
+const defaultOutboxMaxAttempts = 5
+
+func (p *MANPlugin) getOutboxMaxAttempts() int {
+	if p.configuration.OutboxMaxAttempts > 0 {
+		return p.configuration.OutboxMaxAttempts
+	}
+	return defaultOutboxMaxAttempts
+}
+
+// stores in the outbox a digest that could not be sent, so that it will be
+// retried in the next runs. The web version of the digest, if any, is
+// archived when the digest is sent
+func (p *MANPlugin) enqueueDigest(missedActivity *model.TeamMissedActivity, method string, msg *delivery.Message, archived *model.ArchivedDigest, sendErr error) error {
+	now := time.Now()
+	entry := &model.OutboxEntry{
+		ID:        mm_model.NewId(),
+		UserID:    missedActivity.User.ID,
+		Username:  missedActivity.User.Username,
+		TeamName:  missedActivity.Team.Name,
+		Method:    method,
+		Subject:   msg.Subject,
+		Body:      msg.Body,
+		Text:      msg.Text,
+		Thread:    msg.Thread,
+		Archived:  archived,
+		CreatedAt: now.UnixMilli(),
+	}
+	entry.RecordFailure(now, sendErr, p.getOutboxMaxAttempts())
+
+	return p.backend.SaveOutboxEntry(entry)
+}
+
+// sends again the digests in the outbox whose next attempt is due. Digests
+// that fail too many times are marked as failed and their users are flagged
+// (except for the webhook digests)
+func (p *MANPlugin) processOutbox(execLogs *MANRunLog) {
+	entries, err := p.backend.GetOutboxEntries()
+	if err != nil {
+		p.backend.LogError("Error getting outbox entries: %s", err)
+		return
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		if !entry.IsDue(now) {
+			continue
+		}
+
+		errS := p.sendOutboxEntry(entry)
+		if errS == nil {
+			execLogs.textLogs = append(execLogs.textLogs, fmt.Sprintf("Outbox: digest '%s' for user %s sent at attempt %d", entry.Subject, entry.Username, entry.Attempts+1))
+			if entry.Archived != nil {
+				p.archiveDigest(entry.UserID, entry.Archived)
+			}
+			if errD := p.backend.DeleteOutboxEntry(entry.ID); errD != nil {
+				p.backend.LogError("Error deleting outbox entry %s: %s", entry.ID, errD)
+			}
+			continue
+		}
+
+		entry.RecordFailure(now, errS, p.getOutboxMaxAttempts())
+		execLogs.textLogs = append(execLogs.textLogs, fmt.Sprintf("Outbox: error sending digest '%s' to user %s (attempt %d): %s", entry.Subject, entry.Username, entry.Attempts, errS))
+
+		// webhook failures do not depend on the user, so the user is not flagged
+		if entry.Failed && entry.Method == delivery.WebhookMethod {
+			p.backend.LogError("Digest '%s' for user %s not sent to the webhook after %d attempts", entry.Subject, entry.Username, entry.Attempts)
+		} else if entry.Failed {
+			p.backend.LogError("Digest '%s' for user %s not sent after %d attempts, flagging the user", entry.Subject, entry.Username, entry.Attempts)
+			if errF := p.backend.SetUserFlagged(entry.UserID, true, now); errF != nil {
+				p.backend.LogError("Error flagging user %s: %s", entry.Username, errF)
+			}
+		}
+
+		if errU := p.backend.SaveOutboxEntry(entry); errU != nil {
+			p.backend.LogError("Error updating outbox entry %s: %s", entry.ID, errU)
+		}
+	}
+}
+
+func (p *MANPlugin) sendOutboxEntry(entry *model.OutboxEntry) error {
+	// the user is loaded again to use the current email address
+	user, errU := p.backend.GetUser(entry.UserID)
+	if errU != nil {
+		return errors.Wrap(errU, "error getting user")
+	}
+
+	notifier, ok := p.getNotifiers().Lookup(entry.Method)
+	if !ok {
+		return errors.Errorf("delivery method '%s' not available", entry.Method)
+	}
+	return notifier.Send(user, &delivery.Message{Subject: entry.Subject, Body: entry.Body, Text: entry.Text, Thread: entry.Thread})
+}
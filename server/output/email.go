@@ -1,24 +1,22 @@
 package output
 
 import (
-	"bytes"
 	"encoding/base64"
 	"fmt"
 	"html"
 	"html/template"
 	"net/http"
-	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/mergestat/timediff"
 	"github.com/pkg/errors"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
 
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/backend"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/i18n"
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
 )
 
@@ -28,12 +26,50 @@ type EmailTemplateProps struct {
 	FooterLine1 string
 	FooterLine2 string
 	FooterLine3 string
+	// if true, the photos of the senders are referenced as attachments
+	// (see AvatarContentID) instead of being embedded in the html
+	AttachedAvatars bool
+	// if true, the digest is rendered for the web page of the plugin: the
+	// photos of the senders are loaded from Mattermost, where the user is
+	// logged in, and the link to the web page is not shown
+	WebPage bool
+	// how the time of the messages is shown (AbsoluteTime, RelativeTime or AbsoluteAndRelativeTime)
+	TimeFormat string
+	// templates customized by the administrators, nil to use the bundled ones
+	Templates *model.EmailTemplates
+}
+
+// returns the content id of the attachment with the photo of the user
+func AvatarContentID(userID string) string {
+	return "avatar-" + userID + "@man"
+}
+
+var avatarContentIDReg = regexp.MustCompile(`cid:avatar-([a-z0-9]+)@man`)
+
+// returns the ids of the users whose photo is referenced as attachment in the html
+func GetAttachedAvatars(html string) []string {
+	res := []string{}
+	seen := map[string]bool{}
+	for _, m := range avatarContentIDReg.FindAllStringSubmatch(html, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			res = append(res, m[1])
+		}
+	}
+	return res
+}
+
+// removes from the html the references to the attached photo of the user,
+// for photos that cannot be attached
+func RemoveAttachedAvatar(html string, userID string) string {
+	return strings.ReplaceAll(html, "cid:"+AvatarContentID(userID), "")
 }
 
 type postData struct {
 	SenderName               string
 	ChannelName              string
 	Message                  template.HTML
+	Text                     string // the message as written by the author
 	SenderPhoto              template.URL
 	SenderAltPhoto           string
 	PostPhoto                string
@@ -43,6 +79,8 @@ type postData struct {
 	MessageAttachments       []*string
 	Link                     template.URL
 	AlreadyRead              bool
+	Keywords                 []string
+	Mentioned                bool
 }
 
 type conversationData struct {
@@ -59,6 +97,9 @@ type channelData struct {
 	NumRepliesInNotFollowedThreads int
 	NumNotifiedByMM                int
 	NumPreviouslyNotified          int
+	// signed links to stop notifying the channel and to mark it as read
+	ExcludeURL  template.URL
+	MarkReadURL template.URL
 }
 
 func buildChannelData(cma *model.ChannelMissedActivity, conversationsData []*conversationData) *channelData {
@@ -73,8 +114,10 @@ func buildChannelData(cma *model.ChannelMissedActivity, conversationsData []*con
 }
 
 type templateData struct {
-	Props map[string]any
-	HTML  map[string]string
+	// language of the recipient, used by the "t" and "n" template functions
+	Locale string
+	Props  map[string]any
+	HTML   map[string]string
 }
 
 func formatMessage(message string, siteURL string) template.HTML {
@@ -142,53 +185,126 @@ func MarkdownToHTML(markdown, siteURL string) (string, error) {
 	return b.String(), nil
 }
 
-func formatTime(time time.Time) string {
-	return timediff.TimeDiff(time)
+// how the time of the messages is shown in digests
+const (
+	AbsoluteTime            = "absolute"
+	RelativeTime            = "relative"
+	AbsoluteAndRelativeTime = "both"
+)
+
+func formatTime(locale string, time time.Time) string {
+	return i18n.TimeDiff(locale, time)
 }
 
-func BuildHTMLEmail(backend *backend.MattermostBackend, missedActivity *model.TeamMissedActivity, props *EmailTemplateProps) (string, string, error) {
+// returns the time of the message for the user: absolute (in the user's
+// timezone and clock), relative to now, or both
+func FormatPostTime(user *model.User, t time.Time, format string) string {
+	switch format {
+	case RelativeTime:
+		return formatTime(user.Locale, t)
+	case AbsoluteTime:
+		return i18n.FormatTime(user.Locale, t, time.Now(), user.Location(), user.UseMilitaryTime)
+	}
+	absolute := i18n.FormatTime(user.Locale, t, time.Now(), user.Location(), user.UseMilitaryTime)
+	return i18n.T(user.Locale, "time.with_relative", absolute, formatTime(user.Locale, t))
+}
+
+// returns the title of the digest, in the language of the user
+func DigestTitle(backend *backend.MattermostBackend, missedActivity *model.TeamMissedActivity) string {
+	if missedActivity.Team == model.DirectMessagesFakeTeam {
+		return i18n.T(missedActivity.User.Locale, "digest.title.direct", backend.GetServerName())
+	}
+	if missedActivity.Team == model.AllTeamsFakeTeam {
+		return i18n.T(missedActivity.User.Locale, "digest.title.all", backend.GetServerName())
+	}
+	return i18n.T(missedActivity.User.Locale, "digest.title.team", missedActivity.Team.Name)
+}
+
+// returns the link to the post in Mattermost
+func BuildPermalink(backend *backend.MattermostBackend, missedActivity *model.TeamMissedActivity, post *model.Post) string {
+	serverURL := backend.GetServerURL()
+	teamName := missedActivity.Team.Name
+
+	if missedActivity.MergedTeams != nil {
+		// posts of several teams: let Mattermost find the team of the post
+		return fmt.Sprintf("%s/_redirect/pl/%s", serverURL, post.ID)
+	}
+
+	if missedActivity.Team.ID == "" {
+		// although direct messages don't belong to any team, we have to specify a team name in the
+		// url. We choose the first team the user belongs to
+		teams, _ := backend.GetTeamsForUser(missedActivity.User.ID)
+		if len(teams) < 1 {
+			backend.LogError("Cannot build a link for direct message %s: user is not member of any team", post.ID)
+			return serverURL
+		}
+		teamName = teams[0].Name
+	}
+	return fmt.Sprintf("%s/%s/pl/%s", serverURL, strings.ToLower(teamName), post.ID)
+}
+
+// builds the data passed to the email templates and returns it with the
+// number of conversations in it
+func buildTemplateData(backend *backend.MattermostBackend, missedActivity *model.TeamMissedActivity, props *EmailTemplateProps) (*templateData, int) {
 	serverName := backend.GetServerName()
 	serverURL := backend.GetServerURL()
 
 	// closure function to build the link to messages
 	buildMessageLink := func(post *model.Post) template.URL {
-		teamName := missedActivity.Team.Name
-
-		if missedActivity.Team.ID == "" {
-			// although direct messages don't belong to any team, we have to specify a team name in the
-			// url. We choose the first team the user belongs to
-			teams, _ := backend.GetTeamsForUser(missedActivity.User.ID)
-			if len(teams) < 1 {
-				backend.LogError("Cannot build a link for direct message %s: user is not member of any team", post.ID)
-				//nolint:gosec
-				return template.URL(serverURL)
-			}
-			teamName = teams[0].Name
-		}
 		//nolint:gosec
-		return template.URL(fmt.Sprintf("%s/%s/pl/%s", serverURL, strings.ToLower(teamName), post.ID))
+		return template.URL(BuildPermalink(backend, missedActivity, post))
 	}
 
-	t, err := template.ParseFiles(filepath.Join(backend.GetTemplatesPath(), "email-content.html"))
-	if err != nil {
-		return "", "", errors.Wrap(err, "Error loading template")
+	senderPhoto := func(author *model.User) template.URL {
+		if props.WebPage {
+			//nolint:gosec
+			return template.URL(fmt.Sprintf("%s/api/v4/users/%s/image", strings.TrimSuffix(serverURL, "/"), author.ID))
+		}
+		// users without a photo are not attached, the alt text is shown instead
+		if props.AttachedAvatars && len(author.Image) > 0 {
+			//nolint:gosec
+			return template.URL("cid:" + AvatarContentID(author.ID))
+		}
+		return toBase64(author.Image)
 	}
 
-	title := fmt.Sprintf("Missed Activity in the %s team", missedActivity.Team.Name)
-	if missedActivity.Team == model.DirectMessagesFakeTeam {
-		title = fmt.Sprintf("Missed Direct Messages in %s", serverName)
+	// closure function to build the signed links to the actions. If the
+	// link cannot be built, it is left empty and not shown
+	actionURL := func(action string, channelID string) template.URL {
+		res, err := backend.BuildActionURL(missedActivity.User.ID, action, channelID)
+		if err != nil {
+			backend.LogError("Error building the %s link for user %s: %s", action, missedActivity.User.Username, err)
+			return ""
+		}
+		//nolint:gosec
+		return template.URL(res)
 	}
 
-	data := templateData{
+	webURL := ""
+	if missedActivity.DigestID != "" && !props.WebPage {
+		webURL = backend.GetPluginURL() + "/digest?id=" + missedActivity.DigestID
+	}
+
+	locale := missedActivity.User.Locale
+
+	data := &templateData{
+		Locale: locale,
 		Props: map[string]any{
 			"SiteURL":          serverURL,
-			"EmailTitle":       title,
+			"ServerName":       serverName,
+			"TeamName":         missedActivity.Team.Name,
+			"DirectMessages":   missedActivity.Team.ID == "",
+			"AllTeams":         missedActivity.MergedTeams != nil,
+			"EmailTitle":       DigestTitle(backend, missedActivity),
 			"ButtonURL":        serverURL,
 			"EmailSubTitle":    props.SubTitle,
 			"EmailButton":      props.ButtonText,
 			"EmailFooterLine1": props.FooterLine1,
 			"EmailFooterLine2": props.FooterLine2,
 			"EmailFooterLine3": props.FooterLine3,
+			"DisableURL":       actionURL(model.ActionDisable, ""),
+			"SnoozeURL":        actionURL(model.ActionSnooze, ""),
+			"WebURL":           webURL,
 		},
 		HTML: map[string]string{},
 	}
@@ -205,11 +321,14 @@ func BuildHTMLEmail(backend *backend.MattermostBackend, missedActivity *model.Te
 			p := postData{
 				SenderName:     author.DisplayName(),
 				Message:        formatMessage(conv.RootPost.Message, serverURL),
-				Time:           formatTime(conv.RootPost.CreatedAt),
-				SenderPhoto:    toBase64(author.Image),
+				Text:           conv.RootPost.Message,
+				Time:           FormatPostTime(missedActivity.User, conv.RootPost.CreatedAt, props.TimeFormat),
+				SenderPhoto:    senderPhoto(author),
 				SenderAltPhoto: author.AltText,
 				Link:           buildMessageLink(conv.RootPost),
 				AlreadyRead:    !conv.IsRootMessageUnread,
+				Keywords:       conv.GetMatchedKeywords(conv.RootPost),
+				Mentioned:      missedActivity.User.GetMentions(conv.RootPost.Message).IsMentioned(),
 			}
 
 			cv := &conversationData{RootPost: p}
@@ -222,10 +341,13 @@ func BuildHTMLEmail(backend *backend.MattermostBackend, missedActivity *model.Te
 				p := postData{
 					SenderName:     author.DisplayName(),
 					Message:        formatMessage(rep.Message, serverURL),
-					Time:           formatTime(rep.CreatedAt),
-					SenderPhoto:    toBase64(author.Image),
+					Text:           rep.Message,
+					Time:           FormatPostTime(missedActivity.User, rep.CreatedAt, props.TimeFormat),
+					SenderPhoto:    senderPhoto(author),
 					SenderAltPhoto: author.AltText,
 					Link:           buildMessageLink(rep),
+					Keywords:       conv.GetMatchedKeywords(rep),
+					Mentioned:      missedActivity.User.GetMentions(rep.Message).IsMentioned(),
 				}
 				replies = append(replies, p)
 			}
@@ -239,8 +361,11 @@ func BuildHTMLEmail(backend *backend.MattermostBackend, missedActivity *model.Te
 
 		// only add a channel if there is something to notify, otherwise an empty header will appear in the email
 		if len(conversationsData) > 0 || cma.RepliesInNotFollowingConvs > 0 || cma.NotifiedByMMMessages > 0 || cma.PreviouslyNotified > 0 {
-			//nolint:gosec
-			channels = append(channels, buildChannelData(&cma, conversationsData))
+			cd := buildChannelData(&cma, conversationsData)
+			cd.ChannelName = missedActivity.GetChannelName(&cma)
+			cd.ExcludeURL = actionURL(model.ActionExcludeChannel, cma.Channel.ID)
+			cd.MarkReadURL = actionURL(model.ActionMarkRead, cma.Channel.ID)
+			channels = append(channels, cd)
 		}
 	}
 
@@ -254,22 +379,42 @@ func BuildHTMLEmail(backend *backend.MattermostBackend, missedActivity *model.Te
 
 	data.Props["Channels"] = channels
 
+	return data, nConversations
+}
+
+// returns the subject and the html body of the email, empty if there is
+// nothing to notify
+func BuildHTMLEmail(backend *backend.MattermostBackend, missedActivity *model.TeamMissedActivity, props *EmailTemplateProps) (string, string, error) {
+	data, nConversations := buildTemplateData(backend, missedActivity, props)
+
 	// build email only if there is at least one conversation in one channel
-	if nConversations > 0 {
-		w := new(bytes.Buffer)
-		errR := t.Execute(w, data)
-		if errR != nil {
-			return "", "", errors.Wrap(errR, "Error rendering html email template")
-		}
+	if nConversations == 0 {
+		return "", "", nil
+	}
 
-		var subject string
-		if missedActivity.Team.ID != "" {
-			subject = fmt.Sprintf("[%s] Recent activity in %s", serverName, missedActivity.Team.Name)
-		} else {
-			subject = fmt.Sprintf("[%s] Unread direct messages", serverName)
-		}
-		return subject, w.String(), nil
+	body, err := renderTemplate(backend, props.Templates, model.HTMLTemplate, data)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Error rendering html email template")
+	}
+
+	subject, err := renderTemplate(backend, props.Templates, model.SubjectTemplate, data)
+	if err != nil {
+		return "", "", errors.Wrap(err, "Error rendering email subject template")
 	}
 
-	return "", "", nil
+	return subject, body, nil
+}
+
+// returns the plain text version of the email, empty if there is nothing to notify
+func BuildPlainTextEmail(backend *backend.MattermostBackend, missedActivity *model.TeamMissedActivity, props *EmailTemplateProps) (string, error) {
+	data, nConversations := buildTemplateData(backend, missedActivity, props)
+	if nConversations == 0 {
+		return "", nil
+	}
+
+	text, err := renderTemplate(backend, props.Templates, model.TextTemplate, data)
+	if err != nil {
+		return "", errors.Wrap(err, "Error rendering text email template")
+	}
+	return text, nil
 }
@@ -0,0 +1,17 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttachedAvatars(t *testing.T) {
+	html := `<img src="cid:avatar-user1@man"><img src="cid:avatar-user2@man"><img src="cid:avatar-user1@man">`
+
+	assert.Equal(t, []string{"user1", "user2"}, GetAttachedAvatars(html))
+
+	html = RemoveAttachedAvatar(html, "user1")
+	assert.Equal(t, `<img src=""><img src="cid:avatar-user2@man"><img src="">`, html)
+	assert.Equal(t, []string{"user2"}, GetAttachedAvatars(html))
+}
@@ -0,0 +1,146 @@
+package output
+
+import (
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/backend"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+// version of the JSON digest document. It is incremented when fields are
+// removed or their meaning changes (new fields can be added in the same version)
+const DigestDocumentVersion = 1
+
+type DigestDocument struct {
+	Version               int             `json:"version"`
+	Title                 string          `json:"title"`
+	User                  DigestUser      `json:"user"`
+	Team                  DigestTeam      `json:"team"`
+	LastNotifiedTimestamp int64           `json:"last_notified_at"`
+	Channels              []DigestChannel `json:"channels"`
+}
+
+type DigestUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type DigestTeam struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	DirectMessages bool   `json:"direct_messages"`
+}
+
+type DigestChannel struct {
+	ID            string               `json:"id"`
+	Name          string               `json:"name"`
+	Type          string               `json:"type"`
+	Conversations []DigestConversation `json:"conversations"`
+	Counters      DigestCounters       `json:"counters"`
+}
+
+type DigestCounters struct {
+	RepliesInNotFollowedThreads int `json:"replies_in_not_followed_threads"`
+	NotifiedByMattermost        int `json:"notified_by_mattermost"`
+	PreviouslyNotified          int `json:"previously_notified"`
+}
+
+type DigestConversation struct {
+	Following bool         `json:"following"`
+	RootPost  DigestPost   `json:"root_post"`
+	Replies   []DigestPost `json:"replies"`
+}
+
+type DigestPost struct {
+	ID             string   `json:"id"`
+	AuthorID       string   `json:"author_id"`
+	AuthorUsername string   `json:"author_username"`
+	AuthorName     string   `json:"author_name"`
+	Message        string   `json:"message"`
+	CreatedAt      int64    `json:"created_at"`
+	Permalink      string   `json:"permalink"`
+	Unread         bool     `json:"unread"`
+	Mentioned      bool     `json:"mentioned"`
+	Keywords       []string `json:"keywords"`
+}
+
+func buildDigestPost(backend *backend.MattermostBackend, missedActivity *model.TeamMissedActivity, conv *model.UnreadConversation, post *model.Post, unread bool) DigestPost {
+	res := DigestPost{
+		ID:             post.ID,
+		AuthorID:       post.AuthorID,
+		AuthorUsername: post.AuthorID,
+		AuthorName:     post.AuthorID,
+		Message:        post.Message,
+		CreatedAt:      post.CreatedAt.UnixMilli(),
+		Permalink:      BuildPermalink(backend, missedActivity, post),
+		Unread:         unread,
+		Mentioned:      missedActivity.User.GetMentions(post.Message).IsMentioned(),
+		Keywords:       conv.GetMatchedKeywords(post),
+	}
+	if res.Keywords == nil {
+		res.Keywords = []string{}
+	}
+
+	if author, errA := backend.GetUser(post.AuthorID); errA == nil {
+		res.AuthorUsername = author.Username
+		res.AuthorName = author.DisplayName()
+	}
+	return res
+}
+
+// returns the document describing the digest, to be serialized as JSON.
+// It returns nil if there is nothing to notify
+func BuildDigestDocument(backend *backend.MattermostBackend, missedActivity *model.TeamMissedActivity) *DigestDocument {
+	title := DigestTitle(backend, missedActivity)
+
+	doc := &DigestDocument{
+		Version: DigestDocumentVersion,
+		Title:   title,
+		User: DigestUser{
+			ID:       missedActivity.User.ID,
+			Username: missedActivity.User.Username,
+			Email:    missedActivity.User.Email,
+		},
+		Team: DigestTeam{
+			ID:             missedActivity.Team.ID,
+			Name:           missedActivity.Team.Name,
+			DirectMessages: missedActivity.Team.ID == "",
+		},
+		LastNotifiedTimestamp: missedActivity.LastNotifiedTimestamp.UnixMilli(),
+		Channels:              []DigestChannel{},
+	}
+
+	nConversations := 0
+	for _, cma := range missedActivity.UnreadChannels {
+		ch := DigestChannel{
+			ID:            cma.Channel.ID,
+			Name:          cma.GetChannelName(),
+			Type:          cma.Channel.Type,
+			Conversations: []DigestConversation{},
+			Counters: DigestCounters{
+				RepliesInNotFollowedThreads: cma.RepliesInNotFollowingConvs,
+				NotifiedByMattermost:        cma.NotifiedByMMMessages,
+				PreviouslyNotified:          cma.PreviouslyNotified,
+			},
+		}
+
+		for _, conv := range cma.UnreadConversations {
+			dc := DigestConversation{
+				Following: conv.Following,
+				RootPost:  buildDigestPost(backend, missedActivity, conv, conv.RootPost, conv.IsRootMessageUnread),
+				Replies:   []DigestPost{},
+			}
+			for _, rep := range conv.Replies {
+				dc.Replies = append(dc.Replies, buildDigestPost(backend, missedActivity, conv, rep, true))
+			}
+			ch.Conversations = append(ch.Conversations, dc)
+			nConversations++
+		}
+
+		doc.Channels = append(doc.Channels, ch)
+	}
+
+	if nConversations == 0 {
+		return nil
+	}
+	return doc
+}
@@ -0,0 +1,101 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/backend"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/i18n"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+// quotes each line of the message (with the given indentation)
+func quoteMarkdown(message string, indent string) string {
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	for i, l := range lines {
+		lines[i] = indent + "> " + l
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writes the post. Replies are written as list items, so they appear indented
+func writeMarkdownPost(w *bytes.Buffer, backend *backend.MattermostBackend, missedActivity *model.TeamMissedActivity, conv *model.UnreadConversation, post *model.Post, timeFormat string) {
+	prefix, indent := "", ""
+	if !post.IsRoot() {
+		prefix, indent = "- ", "  "
+	}
+
+	authorName := post.AuthorID
+	if author, errA := backend.GetUser(post.AuthorID); errA == nil {
+		authorName = author.DisplayName()
+	}
+
+	badges := ""
+	if missedActivity.User.GetMentions(post.Message).IsMentioned() {
+		badges += " @"
+	}
+	if kws := conv.GetMatchedKeywords(post); len(kws) > 0 {
+		badges += fmt.Sprintf(" 🔔 %s", strings.Join(kws, ", "))
+	}
+
+	locale := missedActivity.User.Locale
+	fmt.Fprintf(w, "%s**%s** · %s · [%s](%s)%s\n", prefix, authorName, FormatPostTime(missedActivity.User, post.CreatedAt, timeFormat), i18n.T(locale, "digest.open"), BuildPermalink(backend, missedActivity, post), badges)
+	fmt.Fprintf(w, "%s\n", quoteMarkdown(post.Message, indent))
+}
+
+// returns the title and the Markdown text of the digest, to be posted in
+// Mattermost. The text is empty if there is nothing to notify
+func BuildMarkdownDigest(backend *backend.MattermostBackend, missedActivity *model.TeamMissedActivity, timeFormat string) (string, string, error) {
+	title := DigestTitle(backend, missedActivity)
+	locale := missedActivity.User.Locale
+
+	channels := make([]model.ChannelMissedActivity, len(missedActivity.UnreadChannels))
+	copy(channels, missedActivity.UnreadChannels)
+	sort.SliceStable(channels, func(i, j int) bool {
+		return missedActivity.GetChannelName(&channels[i]) < missedActivity.GetChannelName(&channels[j])
+	})
+
+	w := new(bytes.Buffer)
+	fmt.Fprintf(w, "#### %s\n", title)
+
+	nConversations := 0
+	for _, cma := range channels {
+		counters := []string{}
+		if cma.RepliesInNotFollowingConvs > 0 {
+			counters = append(counters, i18n.N(locale, "digest.counter.replies_not_followed", cma.RepliesInNotFollowingConvs))
+		}
+		if cma.NotifiedByMMMessages > 0 {
+			counters = append(counters, i18n.N(locale, "digest.counter.notified_by_mm", cma.NotifiedByMMMessages))
+		}
+		if cma.PreviouslyNotified > 0 {
+			counters = append(counters, i18n.N(locale, "digest.counter.previously_notified", cma.PreviouslyNotified))
+		}
+
+		if len(cma.UnreadConversations) == 0 && len(counters) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "\n##### %s\n", missedActivity.GetChannelName(&cma))
+
+		for _, conv := range cma.UnreadConversations {
+			writeMarkdownPost(w, backend, missedActivity, conv, conv.RootPost, timeFormat)
+			for _, rep := range conv.Replies {
+				writeMarkdownPost(w, backend, missedActivity, conv, rep, timeFormat)
+			}
+			fmt.Fprint(w, "\n")
+			nConversations++
+		}
+
+		if len(counters) > 0 {
+			fmt.Fprintf(w, "_+%s_\n", strings.Join(counters, ", "))
+		}
+	}
+
+	if nConversations == 0 {
+		return "", "", nil
+	}
+
+	return title, w.String(), nil
+}
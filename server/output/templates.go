@@ -0,0 +1,204 @@
+package output
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/backend"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/i18n"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+// files of the templates bundled with the plugin, in the templates path
+var bundledTemplateFiles = map[string]string{
+	model.HTMLTemplate:    "email-content.html",
+	model.TextTemplate:    "email-content.txt",
+	model.SubjectTemplate: "email-subject.txt",
+}
+
+// functions available in the text templates
+var textTemplateFuncs = texttemplate.FuncMap{
+	"indent": func(indent string, text string) string {
+		lines := strings.Split(strings.TrimSpace(text), "\n")
+		for i, l := range lines {
+			lines[i] = strings.TrimRight(indent+l, " ")
+		}
+		return strings.Join(lines, "\n")
+	},
+	"join": strings.Join,
+	"underline": func(text string) string {
+		return strings.Repeat("=", len([]rune(text)))
+	},
+}
+
+// functions to translate texts in the language of the recipient:
+// {{t "message.id" args...}} and {{n "message.id" count args...}}
+func i18nTemplateFuncs(locale string) map[string]any {
+	return map[string]any{
+		"t": func(id string, args ...any) string { return i18n.T(locale, id, args...) },
+		"n": func(id string, n int, args ...any) string { return i18n.N(locale, id, n, args...) },
+	}
+}
+
+// renders the template source with the data. Unknown fields are errors, so
+// that mistakes in custom templates are noticed
+func executeTemplate(kind string, source string, data *templateData) (string, error) {
+	w := new(bytes.Buffer)
+	translations := i18nTemplateFuncs(data.Locale)
+
+	if kind == model.HTMLTemplate {
+		t, err := htmltemplate.New(kind).Option("missingkey=error").Funcs(translations).Parse(source)
+		if err != nil {
+			return "", errors.Wrap(err, "error parsing template")
+		}
+		if err = t.Execute(w, data); err != nil {
+			return "", errors.Wrap(err, "error rendering template")
+		}
+		return w.String(), nil
+	}
+
+	t, err := texttemplate.New(kind).Option("missingkey=error").Funcs(textTemplateFuncs).Funcs(translations).Parse(source)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing template")
+	}
+	if err = t.Execute(w, data); err != nil {
+		return "", errors.Wrap(err, "error rendering template")
+	}
+
+	res := w.String()
+	// the subject must be on a single line
+	if kind == model.SubjectTemplate {
+		res = strings.Join(strings.Fields(res), " ")
+	}
+	return res, nil
+}
+
+func executeBundledTemplate(templatesPath string, kind string, data *templateData) (string, error) {
+	source, err := os.ReadFile(filepath.Join(templatesPath, bundledTemplateFiles[kind]))
+	if err != nil {
+		return "", errors.Wrap(err, "Error loading template")
+	}
+	return executeTemplate(kind, string(source), data)
+}
+
+// renders the custom template of the given kind, if any. If there is no
+// custom template or if it fails, the bundled template is used
+func renderTemplate(backend *backend.MattermostBackend, templates *model.EmailTemplates, kind string, data *templateData) (string, error) {
+	if templates != nil && templates.Get(kind) != "" {
+		res, err := executeTemplate(kind, templates.Get(kind), data)
+		if err == nil {
+			return res, nil
+		}
+		backend.LogError("Error rendering the custom %s email template, using the bundled one: %s", kind, err)
+	}
+	return executeBundledTemplate(backend.GetTemplatesPath(), kind, data)
+}
+
+// data used to validate and preview the templates
+func sampleTemplateData(props *EmailTemplateProps, locale string) *templateData {
+	serverURL := "https://mattermost.example.com"
+	user := &model.User{Locale: locale}
+	sampleTime := func(ago time.Duration) string {
+		return FormatPostTime(user, time.Now().Add(-ago), props.TimeFormat)
+	}
+
+	post := func(sender string, message string, time string) postData {
+		return postData{
+			SenderName:     sender,
+			Message:        formatMessage(message, serverURL),
+			Text:           message,
+			Time:           time,
+			SenderAltPhoto: "🐱",
+			//nolint:gosec
+			Link: htmltemplate.URL(serverURL + "/team/pl/samplepostid"),
+		}
+	}
+
+	root := post("Alice Smith", "Can someone review the **release notes** before tomorrow?", sampleTime(2*time.Hour))
+	root.Mentioned = true
+	reply := post("Bob Jones", "Sure, I will do it this afternoon", sampleTime(time.Hour))
+	reply.Keywords = []string{"release"}
+
+	actionURL := func(action string) htmltemplate.URL {
+		//nolint:gosec
+		return htmltemplate.URL(serverURL + "/plugins/" + backend.PluginID + "/action?token=sample" + action)
+	}
+
+	channels := []*channelData{
+		{
+			ChannelName:     "Town Square",
+			ShowChannelIcon: true,
+			Conversations: []*conversationData{
+				{RootPost: root, Replies: []postData{reply}, NumReplies: 1},
+				{RootPost: post("Carol White", "The office will be closed on Friday", sampleTime(3*time.Hour))},
+			},
+			NumRepliesInNotFollowedThreads: 4,
+			NumNotifiedByMM:                2,
+			ExcludeURL:                     actionURL(model.ActionExcludeChannel),
+			MarkReadURL:                    actionURL(model.ActionMarkRead),
+		},
+		{
+			ChannelName:           "Off-Topic",
+			ShowChannelIcon:       true,
+			Conversations:         []*conversationData{{RootPost: post("Bob Jones", "Lunch at 1pm?", sampleTime(20*time.Minute))}},
+			NumPreviouslyNotified: 1,
+			ExcludeURL:            actionURL(model.ActionExcludeChannel),
+			MarkReadURL:           actionURL(model.ActionMarkRead),
+		},
+	}
+
+	return &templateData{
+		Locale: locale,
+		Props: map[string]any{
+			"SiteURL":          serverURL,
+			"ServerName":       "Mattermost",
+			"TeamName":         "Sample Team",
+			"DirectMessages":   false,
+			"AllTeams":         false,
+			"EmailTitle":       i18n.T(locale, "digest.title.team", "Sample Team"),
+			"ButtonURL":        serverURL,
+			"EmailSubTitle":    props.SubTitle,
+			"EmailButton":      props.ButtonText,
+			"EmailFooterLine1": props.FooterLine1,
+			"EmailFooterLine2": props.FooterLine2,
+			"EmailFooterLine3": props.FooterLine3,
+			"DisableURL":       actionURL(model.ActionDisable),
+			"SnoozeURL":        actionURL(model.ActionSnooze),
+			"WebURL":           serverURL + "/plugins/" + backend.PluginID + "/digest?id=sample",
+			"Channels":         channels,
+		},
+		HTML: map[string]string{},
+	}
+}
+
+// renders the custom templates with sample data and returns an error if one of them fails
+func ValidateEmailTemplates(templates *model.EmailTemplates, props *EmailTemplateProps) error {
+	data := sampleTemplateData(props, i18n.DefaultLocale)
+	for _, kind := range model.EmailTemplateKinds {
+		if templates.Get(kind) == "" {
+			continue
+		}
+		if _, err := executeTemplate(kind, templates.Get(kind), data); err != nil {
+			return errors.Wrapf(err, "invalid %s template", kind)
+		}
+	}
+	return nil
+}
+
+// renders the template of the given kind with sample data in the given
+// language. The bundled template is used if there is no custom one. Errors
+// are returned, not replaced by the bundled template
+func PreviewEmailTemplate(templatesPath string, templates *model.EmailTemplates, kind string, props *EmailTemplateProps, locale string) (string, error) {
+	data := sampleTemplateData(props, locale)
+	if templates != nil && templates.Get(kind) != "" {
+		return executeTemplate(kind, templates.Get(kind), data)
+	}
+	return executeBundledTemplate(templatesPath, kind, data)
+}
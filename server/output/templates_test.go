@@ -0,0 +1,58 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+)
+
+const bundledTemplatesPath = "../../assets/templates"
+
+func TestValidateEmailTemplates(t *testing.T) {
+	props := &EmailTemplateProps{ButtonText: "See in Mattermost"}
+
+	assert.NoError(t, ValidateEmailTemplates(&model.EmailTemplates{}, props))
+	assert.NoError(t, ValidateEmailTemplates(&model.EmailTemplates{
+		HTML:    `<h1>{{.Props.EmailTitle}}</h1>{{range .Props.Channels}}<h2>{{.ChannelName}}</h2>{{end}}`,
+		Subject: `New messages in {{.Props.TeamName}}`,
+	}, props))
+
+	// syntax error
+	assert.Error(t, ValidateEmailTemplates(&model.EmailTemplates{Text: `{{range .Props.Channels}}`}, props))
+	// unknown field
+	assert.Error(t, ValidateEmailTemplates(&model.EmailTemplates{Subject: `{{.Props.Team}}`}, props))
+	assert.Error(t, ValidateEmailTemplates(&model.EmailTemplates{HTML: `{{range .Props.Channels}}{{.Name}}{{end}}`}, props))
+}
+
+func TestPreviewEmailTemplate(t *testing.T) {
+	props := &EmailTemplateProps{ButtonText: "See in Mattermost"}
+
+	// bundled templates
+	for _, kind := range model.EmailTemplateKinds {
+		res, err := PreviewEmailTemplate(bundledTemplatesPath, nil, kind, props, "en")
+		require.NoError(t, err)
+		assert.NotEmpty(t, res)
+	}
+
+	subject, err := PreviewEmailTemplate(bundledTemplatesPath, nil, model.SubjectTemplate, props, "en")
+	require.NoError(t, err)
+	assert.Equal(t, "[Mattermost] Recent activity in Sample Team", subject)
+
+	subject, err = PreviewEmailTemplate(bundledTemplatesPath, nil, model.SubjectTemplate, props, "it")
+	require.NoError(t, err)
+	assert.Equal(t, "[Mattermost] Attività recenti in Sample Team", subject)
+
+	// custom subjects are on a single line
+	subject, err = PreviewEmailTemplate(bundledTemplatesPath, &model.EmailTemplates{Subject: "Digest\n  for {{.Props.TeamName}}\n"}, model.SubjectTemplate, props, "en")
+	require.NoError(t, err)
+	assert.Equal(t, "Digest for Sample Team", subject)
+
+	text, err := PreviewEmailTemplate(bundledTemplatesPath, nil, model.TextTemplate, props, "en")
+	require.NoError(t, err)
+	assert.Contains(t, text, "Town Square\n===========\n")
+	assert.Contains(t, text, "See in Mattermost: https://mattermost.example.com")
+	assert.Contains(t, text, "View in browser: https://mattermost.example.com/plugins/com.mattermost.missed-activity-notifier/digest?id=sample")
+}
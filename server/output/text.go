@@ -8,10 +8,10 @@ import (
 	"strings"
 	"time"
 
-	"github.com/mergestat/timediff"
 	"github.com/olekukonko/tablewriter"
 
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/backend"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/i18n"
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
 	"github.com/ggiammat/mattermost-missed-activity-notifier/server/userstatus"
 )
@@ -86,26 +86,27 @@ func PrintUserStatuses(userStatus *userstatus.UserStatusTracker, backend *backen
 
 func PrintTeamMissedActivity(backend *backend.MattermostBackend, missedActivity *model.TeamMissedActivity) string {
 	w := new(bytes.Buffer)
+	locale := missedActivity.User.Locale
 
 	fmt.Fprintf(w, "\n\n▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀\n")
 	fmt.Fprintf(w, "▀ %s in %s\n", missedActivity.User.Username, missedActivity.Team.Name)
 	fmt.Fprintf(w, "▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀▀\n\n")
 
 	for _, crs := range missedActivity.UnreadChannels {
-		fmt.Fprintf(w, "In %s (%s)\n", crs.GetChannelName(), crs.Channel.Type)
+		fmt.Fprintf(w, "%s\n", i18n.T(locale, "log.channel", crs.GetChannelName(), crs.Channel.Type))
 		fmt.Fprintf(w, "▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔▔\n\n")
 
 		for j := 0; j < len(crs.UnreadConversations); j++ {
 			up := crs.UnreadConversations[j]
 			author, _ := backend.GetUser(up.RootPost.AuthorID)
 
-			str5 := timediff.TimeDiff(up.RootPost.CreatedAt)
+			str5 := formatTime(locale, up.RootPost.CreatedAt)
 			followingIcon := ""
 			if up.Following {
 				followingIcon = "🔀 "
 			}
 			mentionIcon := ""
-			if model.MessageContainsMentions(up.RootPost.Message, author.Username) {
+			if missedActivity.User.GetMentions(up.RootPost.Message).IsMentioned() {
 				mentionIcon = "🙊 "
 			}
 			typeIcon := ""
@@ -116,13 +117,21 @@ func PrintTeamMissedActivity(backend *backend.MattermostBackend, missedActivity
 			if up.IsRootMessageUnread {
 				rootUnreadIcon = "🌟 "
 			}
+			keywordsIcon := ""
+			if keywords := up.GetMatchedKeywords(up.RootPost); len(keywords) > 0 {
+				keywordsIcon = fmt.Sprintf("🔔 [%s] ", strings.Join(keywords, ", "))
+			}
 
 			conversationText := up.RootPost.Message
-			fmt.Fprintf(w, "┊ %s %s wrote:  %s%s%s%s\n", author.Username, str5, followingIcon, mentionIcon, typeIcon, rootUnreadIcon)
+			fmt.Fprintf(w, "┊ %s  %s%s%s%s%s\n", i18n.T(locale, "log.wrote", author.Username, str5), followingIcon, mentionIcon, typeIcon, rootUnreadIcon, keywordsIcon)
 			fmt.Fprintf(w, "┊  | %s (type: %s) [at: %d]\n", up.RootPost.Message, up.RootPost.Type, up.RootPost.CreatedAt.UnixMilli())
 			if len(up.Replies) > 0 {
 				for _, r := range up.Replies {
-					fmt.Fprintf(w, "┊  |   > %s [at: %d]\n", r.Message, r.CreatedAt.UnixMilli())
+					replyKeywordsIcon := ""
+					if keywords := up.GetMatchedKeywords(r); len(keywords) > 0 {
+						replyKeywordsIcon = fmt.Sprintf(" 🔔 [%s]", strings.Join(keywords, ", "))
+					}
+					fmt.Fprintf(w, "┊  |   > %s [at: %d]%s\n", r.Message, r.CreatedAt.UnixMilli(), replyKeywordsIcon)
 					author, _ := backend.GetUser(r.AuthorID)
 					conversationText = fmt.Sprintf("%s<br/>  > <strong>%s</strong> replied: %s", conversationText, author.Username, r.Message)
 				}
@@ -132,15 +141,15 @@ func PrintTeamMissedActivity(backend *backend.MattermostBackend, missedActivity
 		}
 
 		if crs.PreviouslyNotified > 0 {
-			fmt.Fprintf(w, "+%d messages previously notified\n", crs.PreviouslyNotified)
+			fmt.Fprintf(w, "+%s\n", i18n.N(locale, "digest.counter.previously_notified", crs.PreviouslyNotified))
 		}
 
 		if crs.RepliesInNotFollowingConvs > 0 {
-			fmt.Fprintf(w, "+%d messages in not followed threads\n", crs.RepliesInNotFollowingConvs)
+			fmt.Fprintf(w, "+%s\n", i18n.N(locale, "digest.counter.replies_not_followed", crs.RepliesInNotFollowingConvs))
 		}
 
 		if crs.NotifiedByMMMessages > 0 {
-			fmt.Fprintf(w, "+%d messages already notified by email by Mattermost\n", crs.NotifiedByMMMessages)
+			fmt.Fprintf(w, "+%s\n", i18n.N(locale, "digest.counter.notified_by_mm", crs.NotifiedByMMMessages))
 		}
 
 		fmt.Fprintf(w, "\n")
@@ -151,6 +160,14 @@ func PrintTeamMissedActivity(backend *backend.MattermostBackend, missedActivity
 			}
 		}
 
+		for _, d := range crs.Decisions {
+			filter := d.Filter
+			if filter == "" {
+				filter = "-"
+			}
+			fmt.Fprintf(w, "░ [%s] [%s] \"%s\": %s\n", d.Decision, filter, d.Message, d.Reason)
+		}
+
 		fmt.Fprintf(w, "\n")
 	}
 
@@ -57,6 +57,9 @@ func (p *MANPlugin) CreateMattermostBackend() error {
 		IncludeCountPreviouslyNotified:            p.configuration.UserDefaultPrefCountPreviouslyNotified,
 		IncludeSystemMessages:                     p.configuration.UserDefaultIncludeSystemMessages,
 		IncludeMessagesFromBots:                   p.configuration.UserDefaultPrefIncludeMessagesFromBots,
+		Schedule:                                  p.configuration.UserDefaultPrefSchedule,
+		DeliveryMethod:                            p.configuration.UserDefaultPrefDeliveryMethod,
+		MergeTeams:                                p.configuration.UserDefaultPrefMergeTeams,
 	}
 
 	backend, err := backend.NewMattermostBackend(
@@ -87,6 +90,17 @@ func (p *MANPlugin) OnActivate() error {
 		if errT != nil {
 			return errors.Wrap(errT, "error setting last notified timestamp")
 		}
+		errU := p.backend.ResetUsersLastNotifiedTimestamps()
+		if errU != nil {
+			return errors.Wrap(errU, "error resetting users last notified timestamps")
+		}
+	}
+
+	// the bot is needed by users that receive digests as direct messages. If
+	// it cannot be created, their digests are sent by email
+	errB := p.backend.EnsureBot()
+	if errB != nil {
+		p.backend.LogError("Error creating the bot, digests will not be sent as direct messages: %s", errB)
 	}
 
 	p.manRunStats = &MANRunStats{
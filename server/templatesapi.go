@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/i18n"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/model"
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/output"
+)
+
+const templatesAPIPath = "/api/v1/templates"
+
+// max size of an uploaded template
+const maxTemplateSize = 1 << 20
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// returns the draft templates. If there is no draft, the draft starts from
+// the published templates
+func (p *MANPlugin) getDraftTemplates() (*model.EmailTemplates, error) {
+	draft, err := p.backend.GetEmailTemplates(true)
+	if err != nil || draft != nil {
+		return draft, err
+	}
+
+	published, err := p.backend.GetEmailTemplates(false)
+	if err != nil || published != nil {
+		return published, err
+	}
+	return &model.EmailTemplates{}, nil
+}
+
+/*
+Admin API to customize the email templates. Templates are edited in a draft,
+that can be previewed with sample data and then published:
+
+	GET    /api/v1/templates                         draft and published templates
+	PUT    /api/v1/templates/draft/{kind}            save a template in the draft (empty body for the bundled one)
+	GET    /api/v1/templates/preview/{kind}          render a template with sample data (?published, ?locale=it)
+	POST   /api/v1/templates/publish                 publish the draft
+	DELETE /api/v1/templates/draft                   discard the draft
+	DELETE /api/v1/templates/published               go back to the bundled templates
+*/
+func (p *MANPlugin) serveTemplatesAPI(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		writeJSONError(w, http.StatusUnauthorized, "not authenticated")
+		return
+	}
+	user, errU := p.backend.GetUser(userID)
+	if errU != nil || !user.IsAdmin() {
+		writeJSONError(w, http.StatusForbidden, "only administrators can manage email templates")
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, templatesAPIPath), "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case path == "" && r.Method == http.MethodGet:
+		draft, errD := p.backend.GetEmailTemplates(true)
+		published, errP := p.backend.GetEmailTemplates(false)
+		if errD != nil || errP != nil {
+			writeJSONError(w, http.StatusInternalServerError, "error loading templates")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]*model.EmailTemplates{"draft": draft, "published": published})
+
+	case len(parts) == 2 && parts[0] == "draft" && r.Method == http.MethodPut:
+		p.saveDraftTemplate(w, r, user, parts[1])
+
+	case len(parts) == 2 && parts[0] == "preview" && r.Method == http.MethodGet:
+		p.previewTemplate(w, r, parts[1])
+
+	case path == "publish" && r.Method == http.MethodPost:
+		p.publishTemplates(w, user)
+
+	case (path == "draft" || path == "published") && r.Method == http.MethodDelete:
+		if errD := p.backend.DeleteEmailTemplates(path == "draft"); errD != nil {
+			writeJSONError(w, http.StatusInternalServerError, errD.Error())
+			return
+		}
+		p.backend.LogInfo("Email templates (%s) deleted by %s", path, user.Username)
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+
+	default:
+		writeJSONError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (p *MANPlugin) saveDraftTemplate(w http.ResponseWriter, r *http.Request, user *model.User, kind string) {
+	if !model.IsEmailTemplateKind(kind) {
+		writeJSONError(w, http.StatusBadRequest, "invalid template kind, valid kinds are: "+strings.Join(model.EmailTemplateKinds, ", "))
+		return
+	}
+
+	source, errR := io.ReadAll(io.LimitReader(r.Body, maxTemplateSize))
+	if errR != nil {
+		writeJSONError(w, http.StatusBadRequest, "error reading the template")
+		return
+	}
+
+	draft, errD := p.getDraftTemplates()
+	if errD != nil {
+		writeJSONError(w, http.StatusInternalServerError, errD.Error())
+		return
+	}
+	draft.Set(kind, string(source))
+
+	// templates are validated before saving, so the draft can always be published
+	if errV := output.ValidateEmailTemplates(draft, p.getEmailTemplateProps()); errV != nil {
+		writeJSONError(w, http.StatusBadRequest, errV.Error())
+		return
+	}
+
+	draft.UpdatedAt = time.Now().UnixMilli()
+	draft.UpdatedBy = user.Username
+	if errS := p.backend.SaveEmailTemplates(true, draft); errS != nil {
+		writeJSONError(w, http.StatusInternalServerError, errS.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, draft)
+}
+
+func (p *MANPlugin) previewTemplate(w http.ResponseWriter, r *http.Request, kind string) {
+	if !model.IsEmailTemplateKind(kind) {
+		writeJSONError(w, http.StatusBadRequest, "invalid template kind, valid kinds are: "+strings.Join(model.EmailTemplateKinds, ", "))
+		return
+	}
+
+	var templates *model.EmailTemplates
+	var err error
+	if r.URL.Query().Has("published") {
+		templates, err = p.backend.GetEmailTemplates(false)
+	} else {
+		templates, err = p.getDraftTemplates()
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	locale := r.URL.Query().Get("locale")
+	if locale == "" {
+		locale = i18n.DefaultLocale
+	}
+
+	res, errP := output.PreviewEmailTemplate(p.backend.GetTemplatesPath(), templates, kind, p.getEmailTemplateProps(), locale)
+	if errP != nil {
+		writeJSONError(w, http.StatusBadRequest, errP.Error())
+		return
+	}
+
+	if kind == model.HTMLTemplate {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	_, _ = io.WriteString(w, res)
+}
+
+func (p *MANPlugin) publishTemplates(w http.ResponseWriter, user *model.User) {
+	draft, errD := p.backend.GetEmailTemplates(true)
+	if errD != nil {
+		writeJSONError(w, http.StatusInternalServerError, errD.Error())
+		return
+	}
+	if draft == nil {
+		writeJSONError(w, http.StatusBadRequest, "there is no draft to publish")
+		return
+	}
+
+	if errV := output.ValidateEmailTemplates(draft, p.getEmailTemplateProps()); errV != nil {
+		writeJSONError(w, http.StatusBadRequest, errV.Error())
+		return
+	}
+
+	draft.UpdatedAt = time.Now().UnixMilli()
+	draft.UpdatedBy = user.Username
+	if errS := p.backend.SaveEmailTemplates(false, draft); errS != nil {
+		writeJSONError(w, http.StatusInternalServerError, errS.Error())
+		return
+	}
+	if errDel := p.backend.DeleteEmailTemplates(true); errDel != nil {
+		p.backend.LogError("Error deleting the draft email templates: %s", errDel)
+	}
+
+	p.backend.LogInfo("Email templates published by %s", user.Username)
+	writeJSON(w, http.StatusOK, draft)
+}
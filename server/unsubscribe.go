@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+
+	"github.com/ggiammat/mattermost-missed-activity-notifier/server/backend"
+)
+
+// the page asks for a confirmation and posts it with the Mattermost CSRF
+// token, so that Mattermost passes the session of the user to the plugin
+const unsubscribePage = `<html><head><meta charset="utf-8"><title>Missed Activity</title></head>
+<body style="font-family: sans-serif; max-width: 600px; margin: 40px auto;">
+<h2>Stop Missed Activity notifications</h2>
+<p>%s</p>
+%s
+<script>
+function unsubscribe() {
+  var csrf = (document.cookie.match(/MMCSRF=([^;]+)/) || [])[1] || "";
+  fetch(window.location.pathname, {method: "POST", credentials: "same-origin", headers: {"X-CSRF-Token": csrf, "X-Requested-With": "XMLHttpRequest"}})
+    .then(function(r) { return r.text(); })
+    .then(function(t) { document.getElementById("result").innerText = t; document.getElementById("confirm").remove(); });
+}
+</script>
+</body></html>`
+
+// disables the plugin for the user logged in Mattermost. It is the target of
+// the List-Unsubscribe header of the emails
+func (p *MANPlugin) serveUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-Id")
+	if userID == "" {
+		loginURL := fmt.Sprintf("%s/login?redirect_to=%s", p.backend.GetServerURL(), url.QueryEscape("/plugins/"+backend.PluginID+"/unsubscribe"))
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, unsubscribePage, fmt.Sprintf("Please <a href=\"%s\">log in to Mattermost</a> first.", html.EscapeString(loginURL)), "")
+		return
+	}
+
+	user, errU := p.backend.GetUser(userID)
+	if errU != nil {
+		p.backend.LogError("Error getting user %s: %s", userID, errU)
+		http.Error(w, "error getting user", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		message := fmt.Sprintf("Hi %s, you will not receive emails about your missed activity anymore. You can enable them again with the <code>/missedactivity prefs Enabled true</code> command.", html.EscapeString(user.Username))
+		fmt.Fprintf(w, unsubscribePage, message, `<button id="confirm" onclick="unsubscribe()">Unsubscribe</button><p id="result"></p>`)
+	case http.MethodPost:
+		if errS := p.backend.SetUserPreference(user, "Enabled", false); errS != nil {
+			p.backend.LogError("Error disabling the plugin for user %s: %s", user.Username, errS)
+			http.Error(w, "error saving preferences", http.StatusInternalServerError)
+			return
+		}
+		p.backend.LogInfo("User %s unsubscribed from the List-Unsubscribe link", user.Username)
+		fmt.Fprint(w, "Done, you have been unsubscribed.")
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -2,6 +2,7 @@ package userstatus
 
 import (
 	"errors"
+	"sync"
 	"time"
 )
 
@@ -25,9 +26,14 @@ type UserStatusHistory struct {
 //nolint:revive
 type UserStatusTracker struct {
 	usersMap map[string]*UserStatusHistory
+	// statuses are tracked while users are processed concurrently
+	lock sync.RWMutex
 }
 
 func (u *UserStatusTracker) GetTrackerUserIds() []string {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
 	keys := make([]string, len(u.usersMap))
 
 	i := 0
@@ -39,6 +45,9 @@ func (u *UserStatusTracker) GetTrackerUserIds() []string {
 }
 
 func (u *UserStatusTracker) GetUserStatusHistory(userID string) ([]int64, []UserStatus) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
 	return u.usersMap[userID].timestamps, u.usersMap[userID].statuses
 }
 
@@ -46,13 +55,19 @@ func NewUserStatusesTracker() *UserStatusTracker {
 	return &UserStatusTracker{usersMap: map[string]*UserStatusHistory{}}
 }
 
-func (u UserStatusTracker) cleanOlderThan(time time.Time) {
+func (u *UserStatusTracker) cleanOlderThan(time time.Time) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
 	for _, v := range u.usersMap {
 		v.clearHistoyOlderThan(time)
 	}
 }
 
-func (u UserStatusTracker) setStatusAtTime(userID string, status string, timestamp int64) error {
+func (u *UserStatusTracker) setStatusAtTime(userID string, status string, timestamp int64) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
 	encS := encodeStatus(status)
 
 	if entry, ok := u.usersMap[userID]; ok {
@@ -67,7 +82,10 @@ func (u UserStatusTracker) setStatusAtTime(userID string, status string, timesta
 	return err
 }
 
-func (u UserStatusTracker) GetStatusForUserAtTime(userID string, time time.Time) UserStatus {
+func (u *UserStatusTracker) GetStatusForUserAtTime(userID string, time time.Time) UserStatus {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
 	if entry, ok := u.usersMap[userID]; ok {
 		return entry.getStatusAt(time)
 	}